@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/yuryqwer/ip2loc/internal"
+)
+
+// The fields compared between two releases, in the order they are reported.
+var fields = []string{"country", "region", "city", "isp", "user_type"}
+
+// summary is the part of a record the diff compares.
+type summary struct {
+	Country  string `json:"country"`
+	Region   string `json:"region"`
+	City     string `json:"city"`
+	ISP      string `json:"isp"`
+	UserType string `json:"user_type"`
+}
+
+// summarize returns the summary of record as the server answers it in
+// lang, so that the diff reports the changes clients would see.
+func summarize(record *geoip2.LocationISP, lang string) summary {
+	if record == nil {
+		return summary{}
+	}
+	info := internal.GetIPInfoFromLocationISP(record, lang)
+	return summary{
+		Country:  info.CountryCode,
+		Region:   info.Region,
+		City:     info.City,
+		ISP:      info.ISP,
+		UserType: info.UserType,
+	}
+}
+
+func (s summary) field(name string) string {
+	switch name {
+	case "country":
+		return s.Country
+	case "region":
+		return s.Region
+	case "city":
+		return s.City
+	case "isp":
+		return s.ISP
+	case "user_type":
+		return s.UserType
+	}
+	return ""
+}
+
+// changedFields returns the fields that differ between old and new.
+func changedFields(old, new summary) []string {
+	var changed []string
+	for _, name := range fields {
+		if old.field(name) != new.field(name) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// span is a range of addresses of one database that share a record.
+type span struct {
+	start, end netip.Addr
+	record     summary
+}
+
+// spans walks the networks of a database as ranges, so that the ranges of
+// two databases can be cut to the same boundaries.
+type spans struct {
+	networks *geoip2.LocationISPNetworks
+	lang     string
+	current  span
+	valid    bool
+	err      error
+}
+
+func newSpans(reader *geoip2.Reader, lang string) *spans {
+	s := &spans{networks: reader.LocationISPNetworks(), lang: lang}
+	s.next()
+	return s
+}
+
+func (s *spans) next() {
+	s.valid = s.networks.Next()
+	if !s.valid {
+		s.err = s.networks.Err()
+		return
+	}
+	prefix, record, err := s.networks.Network()
+	if err != nil {
+		s.valid, s.err = false, err
+		return
+	}
+	s.current = span{start: prefix.Addr(), end: internal.LastAddr(prefix), record: summarize(record, s.lang)}
+}
+
+// advance drops the addresses of the current span up to end included.
+func (s *spans) advance(end netip.Addr) {
+	if end == s.current.end {
+		s.next()
+		return
+	}
+	s.current.start = end.Next()
+}
+
+// A change is a range of addresses whose record differs between the two
+// releases. Old is empty for addresses the old release did not have and
+// New for the ones the new release dropped.
+type change struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Networks []string `json:"networks"`
+	Changed  []string `json:"changed"`
+	Old      summary  `json:"old"`
+	New      summary  `json:"new"`
+
+	ipv4 uint64
+}
+
+// diff walks both databases at once and calls report for every range whose
+// record, localized in lang, differs.
+func diff(old, new *geoip2.Reader, lang string, report func(c *change) error) error {
+	a, b := newSpans(old, lang), newSpans(new, lang)
+	emit := func(start, end netip.Addr, oldRecord, newRecord summary) error {
+		changed := changedFields(oldRecord, newRecord)
+		if len(changed) == 0 {
+			return nil
+		}
+		c := &change{
+			Start:   start.String(),
+			End:     end.String(),
+			Changed: changed,
+			Old:     oldRecord,
+			New:     newRecord,
+		}
+		for _, prefix := range internal.RangePrefixes(start, end) {
+			c.Networks = append(c.Networks, prefix.String())
+			if prefix.Addr().Is4() {
+				c.ipv4 += 1 << (32 - prefix.Bits())
+			}
+		}
+		return report(c)
+	}
+
+	for a.valid || b.valid {
+		var err error
+		switch {
+		case !b.valid || a.valid && a.current.end.Less(b.current.start):
+			// only in the old release
+			err = emit(a.current.start, a.current.end, a.current.record, summary{})
+			a.next()
+		case !a.valid || b.current.end.Less(a.current.start):
+			// only in the new release
+			err = emit(b.current.start, b.current.end, summary{}, b.current.record)
+			b.next()
+		case a.current.start.Less(b.current.start):
+			end := b.current.start.Prev()
+			err = emit(a.current.start, end, a.current.record, summary{})
+			a.advance(end)
+		case b.current.start.Less(a.current.start):
+			end := a.current.start.Prev()
+			err = emit(b.current.start, end, summary{}, b.current.record)
+			b.advance(end)
+		default:
+			end := a.current.end
+			if b.current.end.Less(end) {
+				end = b.current.end
+			}
+			err = emit(a.current.start, end, a.current.record, b.current.record)
+			a.advance(end)
+			b.advance(end)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if a.err != nil {
+		return a.err
+	}
+	return b.err
+}
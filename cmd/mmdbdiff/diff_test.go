@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/yuryqwer/ip2loc/internal"
+	"github.com/yuryqwer/ip2loc/internal/mmdbtest"
+)
+
+// location is a record of a city, the second subdivision as in the dbip's
+// records, in the country code.
+func location(code, city string) map[string]any {
+	record := map[string]any{
+		"country": map[string]any{"iso_code": code, "names": map[string]string{"en": code}},
+	}
+	if city != "" {
+		record["subdivisions"] = []any{
+			map[string]any{"names": map[string]string{"en": "Region"}},
+			map[string]any{"names": map[string]string{"en": city}},
+		}
+	}
+	return record
+}
+
+// openDatabase writes a location database of networks and opens it.
+func openDatabase(t *testing.T, name string, networks map[string]map[string]any) *geoip2.Reader {
+	t.Helper()
+	db := mmdbtest.New("DBIP-Location-ISP (compat=Enterprise)", "en")
+	for network, record := range networks {
+		db.Insert(network, record)
+	}
+	path := filepath.Join(t.TempDir(), name+".mmdb")
+	if err := db.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := internal.NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new map[string]map[string]any
+		// changes are "start-end networks fields old>new", with the
+		// records as country/city
+		changes []string
+		ipv4    uint64
+	}{
+		{
+			name:    "adjacent spans merged",
+			old:     map[string]map[string]any{"1.0.0.0/24": location("CN", "A"), "1.0.1.0/24": location("CN", "B")},
+			new:     map[string]map[string]any{"1.0.0.0/23": location("CN", "A")},
+			changes: []string{"1.0.1.0-1.0.1.255 1.0.1.0/24 city CN/B>CN/A"},
+			ipv4:    256,
+		},
+		{
+			name:    "span split",
+			old:     map[string]map[string]any{"1.0.2.0/23": location("CN", "A")},
+			new:     map[string]map[string]any{"1.0.2.0/24": location("CN", "A"), "1.0.3.0/24": location("JP", "A")},
+			changes: []string{"1.0.3.0-1.0.3.255 1.0.3.0/24 country CN/A>JP/A"},
+			ipv4:    256,
+		},
+		{
+			name: "unaligned spans",
+			old:  map[string]map[string]any{"1.0.4.0/24": location("CN", "A")},
+			new:  map[string]map[string]any{"1.0.4.128/25": location("CN", "B"), "1.0.5.0/24": location("CN", "B")},
+			changes: []string{
+				"1.0.4.0-1.0.4.127 1.0.4.0/25 country,region,city CN/A>/",
+				"1.0.4.128-1.0.4.255 1.0.4.128/25 city CN/A>CN/B",
+				"1.0.5.0-1.0.5.255 1.0.5.0/24 country,region,city />CN/B",
+			},
+			ipv4: 512,
+		},
+		{
+			name: "range on one side only",
+			old:  map[string]map[string]any{"2.0.0.0/24": location("FR", "Paris"), "3.0.0.0/8": location("US", "")},
+			new:  map[string]map[string]any{"3.0.0.0/8": location("US", ""), "4.0.0.0/30": location("US", "")},
+			changes: []string{
+				"2.0.0.0-2.0.0.255 2.0.0.0/24 country,region,city FR/Paris>/",
+				"4.0.0.0-4.0.0.3 4.0.0.0/30 country />US/",
+			},
+			ipv4: 260,
+		},
+		{
+			name: "same records",
+			old:  map[string]map[string]any{"1.0.0.0/24": location("CN", "A"), "2001:db8::/32": location("CN", "A")},
+			new:  map[string]map[string]any{"1.0.0.0/25": location("CN", "A"), "1.0.0.128/25": location("CN", "A"), "2001:db8::/32": location("CN", "A")},
+		},
+		{
+			name: "ipv4 and ipv6 boundary",
+			old:  map[string]map[string]any{"255.255.255.0/24": location("CN", "A"), "2001:db8::/32": location("CN", "A")},
+			new:  map[string]map[string]any{"255.255.255.0/24": location("JP", "A"), "::1:0:0:0/96": location("JP", "A")},
+			changes: []string{
+				"255.255.255.0-255.255.255.255 255.255.255.0/24 country CN/A>JP/A",
+				"::1:0:0:0-::1:0:ffff:ffff ::1:0:0:0/96 country,region,city />JP/A",
+				"2001:db8::-2001:db8:ffff:ffff:ffff:ffff:ffff:ffff 2001:db8::/32 country,region,city CN/A>/",
+			},
+			ipv4: 256,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []string
+			var ipv4 uint64
+			err := diff(openDatabase(t, "old", tt.old), openDatabase(t, "new", tt.new), "en", func(c *change) error {
+				changes = append(changes, fmt.Sprintf("%s-%s %s %s %s/%s>%s/%s", c.Start, c.End, strings.Join(c.Networks, ","),
+					strings.Join(c.Changed, ","), c.Old.Country, c.Old.City, c.New.Country, c.New.City))
+				ipv4 += c.ipv4
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(changes, "\n") != strings.Join(tt.changes, "\n") {
+				t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(changes, "\n"), strings.Join(tt.changes, "\n"))
+			}
+			if ipv4 != tt.ipv4 {
+				t.Errorf("ipv4 = %d, want %d", ipv4, tt.ipv4)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+// Command mmdbdiff compares two releases of a dbip's `IP to Location + ISP`
+// database. It prints how many networks changed their country, region,
+// city, ISP or user type, per field and country, and writes every changed
+// range to a JSONL file.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/yuryqwer/ip2loc/internal"
+)
+
+// count is how much changed for a field in a country.
+type count struct {
+	field, country string
+	networks       int
+	ipv4           uint64
+}
+
+func main() {
+	oldPath := flag.String("old", "", "The mmdb file of the release in production")
+	newPath := flag.String("new", "", "The mmdb file of the release to roll out")
+	out := flag.String("out", "mmdbdiff.jsonl", "Where to write the changed ranges, one JSON object per line; - for stdout")
+	lang := flag.String("lang", internal.DefaultLanguage, "The language the names are compared in, localized like the answers of the server")
+	registerDBTypes := internal.DatabaseTypeFlags(flag.CommandLine)
+	flag.Parse()
+
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	if *oldPath == "" || *newPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := registerDBTypes(); err != nil {
+		errorLog.Fatal(err)
+	}
+
+	oldDB, err := internal.NewDB(*oldPath)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer oldDB.Close()
+	newDB, err := internal.NewDB(*newPath)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer newDB.Close()
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *out != "-" {
+		f, err = os.Create(*out)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		// closed again below to report the errors of the last writes
+		defer f.Close()
+		w = f
+	}
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	encoder.SetEscapeHTML(false)
+
+	counts := make(map[[2]string]*count)
+	err = diff(oldDB, newDB, *lang, func(c *change) error {
+		country := c.Old.Country
+		if country == "" {
+			country = c.New.Country
+		}
+		for _, field := range c.Changed {
+			key := [2]string{field, country}
+			if counts[key] == nil {
+				counts[key] = &count{field: field, country: country}
+			}
+			counts[key].networks += len(c.Networks)
+			counts[key].ipv4 += c.ipv4
+		}
+		return encoder.Encode(c)
+	})
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if err := buffered.Flush(); err != nil {
+		errorLog.Fatal(err)
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	printSummary(counts)
+}
+
+// printSummary prints the counts by field, in the order of fields, then
+// by decreasing number of networks.
+func printSummary(counts map[[2]string]*count) {
+	order := make(map[string]int, len(fields))
+	for i, field := range fields {
+		order[field] = i
+	}
+	sorted := make([]*count, 0, len(counts))
+	for _, c := range counts {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.field != b.field {
+			return order[a.field] < order[b.field]
+		}
+		if a.networks != b.networks {
+			return a.networks > b.networks
+		}
+		return a.country < b.country
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tCOUNTRY\tNETWORKS\tIPV4 ADDRESSES")
+	for _, c := range sorted {
+		country := c.country
+		if country == "" {
+			country = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", c.field, country, c.networks, c.ipv4)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/yuryqwer/ip2loc/internal"
+)
+
+// exportRow is a network of the database as exported, localized like the
+// answers of the API.
+type exportRow struct {
+	Network     string  `json:"network" parquet:"network"`
+	Country     string  `json:"country" parquet:"country"`
+	CountryCode string  `json:"country_code" parquet:"country_code"`
+	Region      string  `json:"region" parquet:"region"`
+	City        string  `json:"city" parquet:"city"`
+	ISP         string  `json:"isp" parquet:"isp"`
+	UserType    string  `json:"user_type" parquet:"user_type"`
+	Latitude    float64 `json:"latitude" parquet:"latitude"`
+	Longitude   float64 `json:"longitude" parquet:"longitude"`
+}
+
+var exportHeader = []string{
+	"network", "country", "country_code", "region", "city", "isp", "user_type", "latitude", "longitude",
+}
+
+type rowWriter interface {
+	Write(row *exportRow) error
+	// Close flushes the rows, it does not close the underlying writer.
+	Close() error
+}
+
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func newCSVRowWriter(w io.Writer) (*csvRowWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportHeader); err != nil {
+		return nil, err
+	}
+	return &csvRowWriter{w: cw}, nil
+}
+
+func (w *csvRowWriter) Write(row *exportRow) error {
+	return w.w.Write([]string{
+		row.Network, row.Country, row.CountryCode, row.Region, row.City, row.ISP, row.UserType,
+		strconv.FormatFloat(row.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(row.Longitude, 'f', -1, 64),
+	})
+}
+
+func (w *csvRowWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type jsonlRowWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newJSONLRowWriter(w io.Writer) *jsonlRowWriter {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	encoder.SetEscapeHTML(false)
+	return &jsonlRowWriter{w: bw, encoder: encoder}
+}
+
+func (w *jsonlRowWriter) Write(row *exportRow) error {
+	return w.encoder.Encode(row)
+}
+
+func (w *jsonlRowWriter) Close() error {
+	return w.w.Flush()
+}
+
+type parquetRowWriter struct {
+	w *parquet.GenericWriter[exportRow]
+}
+
+func (w *parquetRowWriter) Write(row *exportRow) error {
+	_, err := w.w.Write([]exportRow{*row})
+	return err
+}
+
+func (w *parquetRowWriter) Close() error {
+	return w.w.Close()
+}
+
+func newRowWriter(format string, w io.Writer) (rowWriter, error) {
+	switch format {
+	case "csv":
+		return newCSVRowWriter(w)
+	case "jsonl":
+		return newJSONLRowWriter(w), nil
+	case "parquet":
+		return &parquetRowWriter{w: parquet.NewGenericWriter[exportRow](w)}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q, expected csv, jsonl or parquet", format)
+}
+
+// exportFilter keeps the rows that match all of its non-empty fields.
+type exportFilter struct {
+	countries map[string]bool
+	isp       string
+	userType  string
+}
+
+func (f *exportFilter) match(record *internal.Record, info *internal.IPInfo) bool {
+	if len(f.countries) > 0 && !f.countries[strings.ToUpper(info.CountryCode)] {
+		return false
+	}
+	if f.isp != "" &&
+		!strings.Contains(strings.ToLower(record.Traits.ISP), f.isp) &&
+		!strings.Contains(strings.ToLower(info.ISP), f.isp) {
+		return false
+	}
+	if f.userType != "" &&
+		!strings.EqualFold(record.Traits.UserType, f.userType) &&
+		!strings.EqualFold(info.UserType, f.userType) {
+		return false
+	}
+	return true
+}
+
+// runExport is the export subcommand, which writes the networks of an mmdb
+// file in the answers' shape for bulk extracts.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	mmdb := flags.String("mmdb", "./dbip-full.mmdb", "The `IP to Location + ISP` mmdb file to export")
+	registerDBTypes := internal.DatabaseTypeFlags(flags)
+	format := flags.String("format", "csv", "The output format: csv, jsonl or parquet")
+	out := flags.String("out", "-", "The output file; - for stdout")
+	lang := flags.String("lang", "zh-CN", "The language of the names, such as en, zh-CN, zh-TW, zh-HK or any other language of the database")
+	var langFallbacks listFlag
+	flags.Var(&langFallbacks, "lang-fallback", "The languages to try for the names a record lacks in a language, as language=fallback,fallback; may be repeated")
+	ispNamesPath := flags.String("isp-names", "", "A CSV or JSON file of ISP name translations merged over the built-in ones")
+	placeNamesPath := flags.String("place-names", "", "A CSV or JSON file of place names by geoname ID, for the languages the database lacks them in")
+	country := flags.String("country", "", "Only export these country codes, separated with commas")
+	isp := flags.String("isp", "", "Only export the networks whose ISP contains this text, in English or localized")
+	userType := flags.String("user-type", "", "Only export the networks of this user type, such as hosting, in English or localized")
+	flags.Parse(args)
+	if err := registerDBTypes(); err != nil {
+		return err
+	}
+	for _, spec := range langFallbacks {
+		if err := internal.SetLanguageFallback(spec); err != nil {
+			return err
+		}
+	}
+	if *ispNamesPath != "" {
+		if _, err := internal.NewISPNames(*ispNamesPath); err != nil {
+			return err
+		}
+	}
+	if *placeNamesPath != "" {
+		if _, err := internal.NewPlaceNames(*placeNamesPath); err != nil {
+			return err
+		}
+	}
+
+	filter := &exportFilter{isp: strings.ToLower(*isp), userType: *userType}
+	for _, code := range strings.Split(*country, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			if filter.countries == nil {
+				filter.countries = make(map[string]bool)
+			}
+			filter.countries[strings.ToUpper(code)] = true
+		}
+	}
+
+	reader, err := internal.NewDB(*mmdb)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if *out != "-" {
+		f, err = os.Create(*out)
+		if err != nil {
+			return err
+		}
+		// closed again below to report the errors of the last writes
+		defer f.Close()
+		w = f
+	}
+	rows, err := newRowWriter(*format, w)
+	if err != nil {
+		return err
+	}
+
+	networks := reader.LocationISPNetworks()
+	for networks.Next() {
+		prefix, record, err := networks.Network()
+		if err != nil {
+			return err
+		}
+		info := internal.GetIPInfoFromLocationISP(record, *lang)
+		if !filter.match(record, info) {
+			continue
+		}
+		err = rows.Write(&exportRow{
+			Network:     prefix.String(),
+			Country:     info.Country,
+			CountryCode: info.CountryCode,
+			Region:      info.Region,
+			City:        info.City,
+			ISP:         info.ISP,
+			UserType:    info.UserType,
+			Latitude:    info.Latitude,
+			Longitude:   info.Longitude,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := networks.Err(); err != nil {
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if f != nil {
+		return f.Close()
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
-	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/yuryqwer/ip2loc/internal"
 )
@@ -14,63 +17,254 @@ func (app *application) report(w http.ResponseWriter, r *http.Request) {
 	if ip == "" {
 		ip = getDefaultIP(r)
 	}
-	address := net.ParseIP(ip)
-	if address == nil {
+	address, err := netip.ParseAddr(ip)
+	if err != nil {
 		app.infoLog.Printf("given ip is %s, which is not valid", ip)
 		app.notFound(w, "please enter the right ip")
 		return
 	}
 
-	info, err := internal.GetIPInfo(address.String(), app.db)
+	info, err := app.db.LookupIPInfo(address, languageOf(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	if info.Reserved != nil {
+		respondJsonSuccess(w, ip, reservedReport{Reserved: info.Reserved})
+		return
+	}
+	record, err := app.db.Lookup(address)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	respondJsonSuccess(w, ip, info)
+	respondJsonSuccess(w, ip, localizedReport{Record: record, Localized: info})
+}
+
+// localizedReport is the full record of an address along with its info in
+// the language of the request.
+type localizedReport struct {
+	*internal.Record
+	Localized *internal.IPInfo `json:"localized"`
+}
+
+// reservedReport is the report of a special-purpose address, which no
+// database has a record for.
+type reservedReport struct {
+	Reserved *internal.ReservedRange `json:"reserved"`
 }
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
-	if _, ok := map[string]bool{
-		"/":        true,
-		"/json":    true,
-		"/en":      true,
-		"/en/json": true,
-	}[r.URL.Path]; !ok {
+	// a /{lang} prefix was stripped by negotiateLanguage
+	if r.URL.Path != "/" && r.URL.Path != "/json" {
 		app.notFound(w, http.StatusText(http.StatusNotFound))
 		return
 	}
 
 	ip := getDefaultIP(r)
-	address := net.ParseIP(ip)
-	if address == nil {
+	address, err := netip.ParseAddr(ip)
+	if err != nil {
 		app.infoLog.Printf("given ip is %s, which is not valid", ip)
 		app.clientError(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	info, err := internal.GetIPInfo(address.String(), app.db)
+	lang := languageOf(r)
+	ipInfo, err := app.db.LookupIPInfo(address, lang)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	var ipInfo *internal.IPInfo
-	if strings.Contains(r.URL.Path, "en") {
-		ipInfo = internal.GetIPInfoFromLocationISP(info, "en")
-	} else {
-		ipInfo = internal.GetIPInfoFromLocationISP(info, "zh-CN")
-	}
-
-	if strings.Contains(r.URL.Path, "json") {
+	// the text answers are in Chinese, converted for Traditional Chinese, or
+	// in English
+	chinese := strings.HasPrefix(lang, "zh")
+	if r.URL.Path == "/json" {
 		respondJsonSuccess(w, ip, ipInfo)
+	} else if ipInfo.Reserved != nil {
+		// most likely a proxy that does not pass on the address of the client
+		if !chinese {
+			fmt.Fprintf(w, "Your IP: %s is in the %s range (%s), which has no location. "+
+				"If you are behind a proxy or a VPN, it may not be passing on your address.\n",
+				ip, ipInfo.Reserved.Name, ipInfo.Reserved.RFC)
+		} else {
+			fmt.Fprintf(w, internal.ToTraditional("当前 IP：%s 属于特殊用途地址段 %s（%s），没有地理位置信息。"+
+				"如果你通过代理或 VPN 访问，可能是代理没有正确传递你的地址。\n", lang),
+				ip, ipInfo.Reserved.Name, ipInfo.Reserved.RFC)
+		}
 	} else {
-		if strings.Contains(r.URL.Path, "en") {
+		if !chinese {
+			if ipInfo.Tunnel != nil {
+				ip = fmt.Sprintf("%s (%s, IPv4 %s)", ip, ipInfo.Tunnel.Type, ipInfo.Tunnel.IPv4)
+			}
 			fmt.Fprintf(w, "Your IP: %s\tLocation: %s\tIsp: %s\tUserType: %s\n",
 				ip, ipInfo.Country+" "+ipInfo.Region+" "+ipInfo.City, ipInfo.ISP, ipInfo.UserType)
 		} else {
-			fmt.Fprintf(w, "当前 IP：%s\t来自于：%s\t运营商：%s\t用户类型：%s\n",
+			if ipInfo.Tunnel != nil {
+				ip = fmt.Sprintf("%s（%s，IPv4 %s）", ip, ipInfo.Tunnel.Type, ipInfo.Tunnel.IPv4)
+			}
+			fmt.Fprintf(w, internal.ToTraditional("当前 IP：%s\t来自于：%s\t运营商：%s\t用户类型：%s\n", lang),
 				ip, ipInfo.Country+" "+ipInfo.Region+" "+ipInfo.City, ipInfo.ISP, ipInfo.UserType)
 		}
 	}
 }
+
+func (app *application) cacheStats(w http.ResponseWriter, r *http.Request) {
+	if app.merged == nil {
+		app.notFound(w, "the cache is disabled")
+		return
+	}
+	stats, ok := app.merged.CacheStats()
+	if !ok {
+		app.notFound(w, "the cache is disabled")
+		return
+	}
+	respondJsonSuccess(w, getDefaultIP(r), stats)
+}
+
+const (
+	defaultUntranslatedLimit = 100
+	maxUntranslatedLimit     = 10000
+)
+
+// untranslated lists the most queried places answered in another language
+// than the one asked for, of the language given as lang, or of all of them
+// when it is "all".
+func (app *application) untranslated(w http.ResponseWriter, r *http.Request) {
+	if app.merged == nil {
+		app.notFound(w, "untranslated places are only counted for mmdb databases")
+		return
+	}
+	query := r.URL.Query()
+	lang := query.Get("lang")
+	switch lang {
+	case "":
+		lang = app.defaultLanguage
+	case "all":
+		lang = ""
+	default:
+		lang = internal.CanonicalLanguage(lang)
+	}
+	limit := defaultUntranslatedLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUntranslatedLimit {
+			app.notFound(w, fmt.Sprintf("limit must be between 1 and %d", maxUntranslatedLimit))
+			return
+		}
+		limit = n
+	}
+	respondJsonSuccess(w, getDefaultIP(r), internal.UntranslatedPlaces(lang, limit))
+}
+
+// databaseMeta describes a database in use, as served by /v1/meta. The
+// fields from node_count on are only known for mmdb files.
+type databaseMeta struct {
+	Role         string            `json:"role"`
+	Path         string            `json:"path"`
+	DatabaseType string            `json:"database_type"`
+	BuildDate    string            `json:"build_date"`
+	BuildEpoch   uint              `json:"build_epoch"`
+	Languages    []string          `json:"languages"`
+	IPVersion    uint              `json:"ip_version"`
+	NodeCount    uint              `json:"node_count,omitempty"`
+	RecordSize   uint              `json:"record_size,omitempty"`
+	Version      string            `json:"binary_format_version,omitempty"`
+	Description  map[string]string `json:"description,omitempty"`
+	MD5          string            `json:"md5"`
+	LoadedAt     string            `json:"loaded_at"`
+}
+
+func (app *application) meta(w http.ResponseWriter, r *http.Request) {
+	files := make(map[string]*watchedFile, len(app.files))
+	for _, f := range app.files {
+		files[f.path] = f
+	}
+	databases := []databaseMeta{}
+	for _, info := range app.db.Databases() {
+		m := databaseMeta{
+			Role:         info.Role,
+			Path:         info.Path,
+			DatabaseType: info.DatabaseType,
+			BuildEpoch:   info.BuildEpoch,
+			Languages:    info.Languages,
+			IPVersion:    info.IPVersion,
+			NodeCount:    info.NodeCount,
+			RecordSize:   info.RecordSize,
+			Version:      info.BinaryFormatVersion,
+			Description:  info.Description,
+		}
+		if info.BuildEpoch != 0 {
+			m.BuildDate = time.Unix(int64(info.BuildEpoch), 0).UTC().Format("2006-01-02")
+		}
+		if f := files[info.Path]; f != nil {
+			sum, loaded := f.state()
+			m.MD5 = hex.EncodeToString(sum)
+			m.LoadedAt = loaded.Format(time.RFC3339)
+		}
+		databases = append(databases, m)
+	}
+	respondJsonSuccess(w, getDefaultIP(r), databases)
+}
+
+// networksPage is a page of the answer to a reverse query.
+type networksPage struct {
+	Total    int      `json:"total"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"page_size"`
+	Networks []string `json:"networks"`
+}
+
+const (
+	defaultNetworksPageSize = 1000
+	maxNetworksPageSize     = 10000
+)
+
+func (app *application) networks(w http.ResponseWriter, r *http.Request) {
+	if app.networkIndex == nil {
+		app.notFound(w, "reverse queries are disabled")
+		return
+	}
+	query := r.URL.Query()
+	q := internal.NetworkQuery{
+		Country:  query.Get("country"),
+		Region:   query.Get("region"),
+		ISP:      query.Get("isp"),
+		UserType: query.Get("user_type"),
+	}
+	if q == (internal.NetworkQuery{}) {
+		app.notFound(w, "please give a country, region, isp or user_type")
+		return
+	}
+	page, pageSize := 1, defaultNetworksPageSize
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			app.notFound(w, "page must be a positive number")
+			return
+		}
+		page = n
+	}
+	if v := query.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxNetworksPageSize {
+			app.notFound(w, fmt.Sprintf("page_size must be between 1 and %d", maxNetworksPageSize))
+			return
+		}
+		pageSize = n
+	}
+
+	found := app.networkIndex.Load().Find(q)
+	result := networksPage{Total: len(found), Page: page, PageSize: pageSize, Networks: []string{}}
+	// pages past the end are empty; checking before multiplying keeps a
+	// large page from overflowing
+	if page-1 <= len(found)/pageSize {
+		start := (page - 1) * pageSize
+		end := min(start+pageSize, len(found))
+		for _, network := range found[start:end] {
+			result.Networks = append(result.Networks, network.String())
+		}
+	}
+	respondJsonSuccess(w, getDefaultIP(r), result)
+}
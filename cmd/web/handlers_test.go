@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuryqwer/ip2loc/internal"
+	"github.com/yuryqwer/ip2loc/internal/mmdbtest"
+	"golang.org/x/text/language"
+)
+
+// stubLocator answers every address with the same record.
+type stubLocator struct {
+	record    *internal.Record
+	err       error
+	databases []internal.DatabaseInfo
+}
+
+func (l *stubLocator) Lookup(addr netip.Addr) (*internal.Record, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.record, nil
+}
+
+func (l *stubLocator) LookupIPInfo(addr netip.Addr, lang string) (*internal.IPInfo, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	return internal.GetIPInfoFromLocationISP(l.record, lang), nil
+}
+
+func (l *stubLocator) Databases() []internal.DatabaseInfo {
+	return l.databases
+}
+
+func (l *stubLocator) Close() error {
+	return nil
+}
+
+func newStubRecord() *internal.Record {
+	var record internal.Record
+	record.Country.IsoCode = "US"
+	record.Country.Names = map[string]string{"en": "United States", "zh-CN": "美国"}
+	record.City.Names = map[string]string{"en": "Mountain View", "zh-CN": "山景城"}
+	record.Traits.ISP = "Google LLC"
+	return &record
+}
+
+// newTestApplication returns the application main would serve db with,
+// wrapped the same way.
+func newTestApplication(db internal.Locator) *application {
+	languages := supportedLanguages(internal.DefaultLanguage, nil)
+	tags := make([]language.Tag, len(languages))
+	for i, lang := range languages {
+		tags[i] = language.Make(lang)
+	}
+	return &application{
+		errorLog:        log.New(io.Discard, "", 0),
+		infoLog:         log.New(io.Discard, "", 0),
+		db:              internal.WithTunnels(internal.WithReserved(db)),
+		limiter:         internal.NewIPRateLimiter(1, 5),
+		languages:       languages,
+		languageMatcher: language.NewMatcher(tags),
+		defaultLanguage: languages[0],
+	}
+}
+
+func serve(t *testing.T, app *application, r *http.Request) (*http.Response, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, r)
+	response := w.Result()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, string(body)
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		err      error
+		status   int
+		code     int
+		contains string
+	}{
+		{name: "zh-CN", target: "/v1/report?ip=8.8.8.8", status: http.StatusOK, code: 1, contains: `"country":"美国"`},
+		{name: "en", target: "/v1/report?ip=8.8.8.8&lang=en", status: http.StatusOK, code: 1, contains: `"country":"United States"`},
+		{name: "client address", target: "/v1/report", status: http.StatusOK, code: 1, contains: `"iso_code":"US"`},
+		{name: "invalid", target: "/v1/report?ip=8.8.8", status: http.StatusNotFound, code: 2},
+		{name: "reserved", target: "/v1/report?ip=192.168.1.1", status: http.StatusOK, code: 1, contains: `"reserved":{`},
+		{name: "reserved in a tunnel", target: "/v1/report?ip=2002:c0a8:101::1", status: http.StatusOK, code: 1, contains: `"reserved":{`},
+		{name: "error", target: "/v1/report?ip=8.8.8.8", err: errors.New("closed"), status: http.StatusInternalServerError, code: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(&stubLocator{record: newStubRecord(), err: tt.err})
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Header.Set("X-Forwarded-For", "8.8.4.4")
+			r.Header.Set("Origin", "https://ip.smartproxy.cn")
+			response, body := serve(t, app, r)
+			if response.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d: %s", response.StatusCode, tt.status, body)
+			}
+			if got := response.Header.Get("Access-Control-Allow-Origin"); got != "https://ip.smartproxy.cn" {
+				t.Errorf("Access-Control-Allow-Origin = %q", got)
+			}
+			var result jsonResponse
+			if err := json.Unmarshal([]byte(body), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Code != tt.code {
+				t.Errorf("code = %d, want %d", result.Code, tt.code)
+			}
+			if !strings.Contains(body, tt.contains) {
+				t.Errorf("%s does not contain %s", body, tt.contains)
+			}
+		})
+	}
+}
+
+func TestHomeLanguage(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		acceptLanguage string
+		lang           string
+		contains       string
+	}{
+		{name: "default", target: "/", lang: "zh-CN", contains: "来自于：美国"},
+		{name: "query", target: "/?lang=en", lang: "en", contains: "Location: United States"},
+		{name: "query region", target: "/?lang=en-US", lang: "en", contains: "Location: United States"},
+		{name: "prefix", target: "/en", lang: "en", contains: "Location: United States"},
+		{name: "prefix json", target: "/zh-Hant/json", lang: "zh-TW", contains: `"country":"美國"`},
+		{name: "query over prefix", target: "/en/json?lang=zh", lang: "zh-CN", contains: `"country":"美国"`},
+		{name: "accept language", target: "/json", acceptLanguage: "fr-CH, en;q=0.8", lang: "en", contains: `"country":"United States"`},
+		{name: "unknown", target: "/?lang=xx", lang: "zh-CN", contains: "来自于：美国"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(&stubLocator{record: newStubRecord()})
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Header.Set("X-Forwarded-For", "8.8.4.4")
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			response, body := serve(t, app, r)
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d: %s", response.StatusCode, body)
+			}
+			if got := response.Header.Get("Content-Language"); got != tt.lang {
+				t.Errorf("Content-Language = %q, want %q", got, tt.lang)
+			}
+			if !strings.Contains(body, tt.contains) {
+				t.Errorf("%s does not contain %s", body, tt.contains)
+			}
+		})
+	}
+}
+
+func TestHomeRateLimit(t *testing.T) {
+	app := newTestApplication(&stubLocator{record: newStubRecord()})
+	status := func(ip string) int {
+		r := httptest.NewRequest(http.MethodGet, "/json", nil)
+		r.Header.Set("X-Forwarded-For", ip)
+		response, _ := serve(t, app, r)
+		return response.StatusCode
+	}
+	for i := 0; i < 5; i++ {
+		if got := status("8.8.4.4"); got != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, got)
+		}
+	}
+	if got := status("8.8.4.4"); got != http.StatusTooManyRequests {
+		t.Errorf("status = %d past the burst, want %d", got, http.StatusTooManyRequests)
+	}
+	if got := status("8.8.8.8"); got != http.StatusOK {
+		t.Errorf("status = %d for another client, want %d", got, http.StatusOK)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	app := newTestApplication(&stubLocator{databases: []internal.DatabaseInfo{
+		{Role: internal.RoleLocation, Path: "qqwry.dat", DatabaseType: "qqwry", BuildEpoch: 1704844800, IPVersion: 4},
+		{Role: internal.RoleASN, Path: "asn.mmdb", DatabaseType: "GeoLite2-ASN", NodeCount: 10, BinaryFormatVersion: "2.0"},
+	}})
+	app.files = []*watchedFile{newWatchedFile("qqwry.dat", "qqwry", []byte{0xab, 0xcd}, nil)}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/meta", nil)
+	response, body := serve(t, app, r)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", response.StatusCode, body)
+	}
+	var result struct {
+		Data []databaseMeta `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Data) != 2 {
+		t.Fatalf("got %d databases, want 2: %s", len(result.Data), body)
+	}
+	if m := result.Data[0]; m.DatabaseType != "qqwry" || m.BuildDate != "2024-01-10" || m.MD5 != "abcd" || m.LoadedAt == "" {
+		t.Errorf("qqwry.dat: %+v", m)
+	}
+	if m := result.Data[1]; m.Role != internal.RoleASN || m.BuildDate != "" || m.NodeCount != 10 || m.MD5 != "" {
+		t.Errorf("asn.mmdb: %+v", m)
+	}
+
+	app = newTestApplication(&stubLocator{})
+	_, body = serve(t, app, httptest.NewRequest(http.MethodGet, "/v1/meta", nil))
+	if !strings.Contains(body, `"data":[]`) {
+		t.Errorf("%s does not list an empty array", body)
+	}
+}
+
+func TestNetworksDisabled(t *testing.T) {
+	app := newTestApplication(&stubLocator{record: newStubRecord()})
+	r := httptest.NewRequest(http.MethodGet, "/v1/networks?country=US", nil)
+	if response, body := serve(t, app, r); response.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d: %s", response.StatusCode, body)
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	db := mmdbtest.New("DBIP-Location-ISP (compat=Enterprise)", "en")
+	db.Insert("8.8.8.0/24", map[string]any{"country": map[string]any{"iso_code": "US"}})
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := db.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	source := &internal.Source{Role: internal.RoleLocation, Path: path}
+	if err := source.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer source.Reader().Close()
+	merged, err := internal.NewMerged([]*internal.Source{source}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newTestApplication(merged)
+	app.merged = merged
+
+	for _, target := range []string{"/v1/cache", "/v1/untranslated?lang=all"} {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if response, body := serve(t, app, r); response.StatusCode != http.StatusNotFound {
+			t.Errorf("%s is public: status = %d: %s", target, response.StatusCode, body)
+		}
+		w := httptest.NewRecorder()
+		app.adminRoutes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"data":`) {
+			t.Errorf("%s on the admin listener: status = %d: %s", target, w.Code, w.Body)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/yuryqwer/ip2loc/internal"
+	"golang.org/x/text/language"
 )
 
 type jsonResponse struct {
@@ -82,6 +83,21 @@ func getDefaultIP(r *http.Request) string {
 	return ip
 }
 
+// fileSum returns the md5 checksum of the file at path.
+func fileSum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
 func (app *application) watchAndReload(watcher *fsnotify.Watcher) {
 	for {
 		select {
@@ -91,34 +107,26 @@ func (app *application) watchAndReload(watcher *fsnotify.Watcher) {
 				app.errorLog.Println("watchAndReload error: watcher.Events has benn closed")
 				return
 			}
-			if (event.Op == fsnotify.Write || event.Op == fsnotify.Create) &&
-				filepath.Base(event.Name) == app.mmdbName {
-				f, err := os.Open(event.Name)
-				if err != nil {
-					app.infoLog.Println("watchAndReload error:", err)
+			if event.Op != fsnotify.Write && event.Op != fsnotify.Create {
+				continue
+			}
+			for _, f := range app.files {
+				if filepath.Clean(event.Name) != filepath.Clean(f.path) {
 					continue
 				}
-
-				h := md5.New()
-				if _, err := io.Copy(h, f); err != nil {
-					f.Close()
+				sum, err := fileSum(event.Name)
+				if err != nil {
 					app.infoLog.Println("watchAndReload error:", err)
 					continue
 				}
-				sum := h.Sum(nil)
-				f.Close()
 
-				if !bytes.Equal(sum, app.mmdbSum) {
-					db, err := internal.NewDB(event.Name)
-					if err != nil {
+				if current, _ := f.state(); !bytes.Equal(sum, current) {
+					if err := f.reload(); err != nil {
 						app.infoLog.Println("watchAndReload error:", err)
 						continue
 					}
-					defer db.Close()
-					app.db.Close()
-					app.db = db
-					app.mmdbSum = sum
-					app.infoLog.Println("watchAndReload change the mmdb")
+					f.setLoaded(sum)
+					app.infoLog.Printf("watchAndReload change the %s %s", f.kind, f.path)
 				}
 			}
 		case _, ok := <-watcher.Errors:
@@ -129,3 +137,58 @@ func (app *application) watchAndReload(watcher *fsnotify.Watcher) {
 		}
 	}
 }
+
+type contextKey string
+
+const languageContextKey = contextKey("language")
+
+// languageOf returns the language negotiateLanguage resolved for r.
+func languageOf(r *http.Request) string {
+	if lang, ok := r.Context().Value(languageContextKey).(string); ok {
+		return lang
+	}
+	return internal.DefaultLanguage
+}
+
+// matchLanguage returns the language the server knows that best matches
+// tags, in order of preference, and false when none does.
+func (app *application) matchLanguage(tags ...language.Tag) (string, bool) {
+	if _, i, confidence := app.languageMatcher.Match(tags...); confidence != language.No {
+		return app.languages[i], true
+	}
+	return "", false
+}
+
+// supportedLanguages returns the languages answers can be negotiated in:
+// the default one, Chinese, English and Traditional Chinese, the ones of
+// the names of the location databases, and the ones with fallbacks.
+func supportedLanguages(defaultLanguage string, merged *internal.Merged) []string {
+	langs := []string{defaultLanguage}
+	add := func(lang string) {
+		lang = internal.CanonicalLanguage(lang)
+		for _, l := range langs {
+			if l == lang {
+				return
+			}
+		}
+		langs = append(langs, lang)
+	}
+	add("zh-CN")
+	add("en")
+	add(internal.LanguageTaiwan)
+	add(internal.LanguageHongKong)
+	if merged != nil {
+		for _, s := range merged.Sources() {
+			if s.Role != internal.RoleLocation {
+				continue
+			}
+			for _, lang := range s.Reader().Metadata().Languages {
+				add(lang)
+			}
+		}
+	}
+	for _, lang := range internal.FallbackLanguages() {
+		add(lang)
+	}
+	return langs
+}
@@ -1,55 +1,248 @@
 package main
 
 import (
-	"crypto/md5"
+	"errors"
 	"flag"
-	"io"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
-	"github.com/oschwald/geoip2-golang"
 	"github.com/yuryqwer/ip2loc/internal"
+	"golang.org/x/text/language"
 )
 
 type application struct {
 	errorLog *log.Logger
 	infoLog  *log.Logger
-	db       *geoip2.Reader
+	db       internal.Locator
+	merged   *internal.Merged
 	limiter  *internal.IPRateLimiter
-	mmdbName string
-	mmdbSum  []byte
+	files    []*watchedFile
+	// languages are the ones answers can be negotiated in, the default
+	// one first, and languageMatcher matches Accept-Language against them.
+	languages       []string
+	languageMatcher language.Matcher
+	defaultLanguage string
+	// networkIndex answers reverse queries, nil when they are disabled.
+	networkIndex *atomic.Pointer[internal.NetworkIndex]
+}
+
+// watchedFile is a data file that is hot-reloaded when its content changes.
+type watchedFile struct {
+	path   string
+	kind   string
+	reload func() error
+	// source is the database loaded from the file, nil for other files.
+	source *internal.Source
+
+	mu     sync.Mutex
+	sum    []byte
+	loaded time.Time
+}
+
+func newWatchedFile(path, kind string, sum []byte, reload func() error) *watchedFile {
+	return &watchedFile{path: path, kind: kind, reload: reload, sum: sum, loaded: time.Now()}
+}
+
+// state returns the checksum of the file in use and when it was loaded.
+func (f *watchedFile) state() ([]byte, time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sum, f.loaded
+}
+
+func (f *watchedFile) setLoaded(sum []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sum = sum
+	f.loaded = time.Now()
+}
+
+// listFlag collects a flag that can be given several times.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		subcommands := map[string]func([]string) error{
+			"export":       runExport,
+			"untranslated": runUntranslated,
+		}
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	addr := flag.String("addr", ":4000", "HTTP network address")
-	mmdb := flag.String("mmdb", "./dbip-full.mmdb", "The mmdb file path")
+	adminAddr := flag.String("admin-addr", "localhost:4001", "HTTP network address of the admin endpoints, /v1/cache and /v1/untranslated; empty disables them")
+	var mmdbPaths listFlag
+	flag.Var(&mmdbPaths, "mmdb", "The mmdb file path, as [role=]path where role is location (default), asn or anonymous-ip; may be repeated")
+	registerDBTypes := internal.DatabaseTypeFlags(flag.CommandLine)
+	defaultLang := flag.String("default-lang", internal.DefaultLanguage, "The language of the answers when the request asks for none")
+	var langFallbacks listFlag
+	flag.Var(&langFallbacks, "lang-fallback", "The languages to try for the names a record lacks in a language, as language=fallback,fallback such as zh-TW=zh-CN,en; may be repeated")
+	cacheSize := flag.Int("cache-size", 65536, "How many answers, keyed by network and language, to cache; 0 disables the cache")
+	inMemory := flag.Bool("in-memory", false, "Read the mmdb files into memory instead of mapping them, so that overwriting one in place cannot affect the server")
+	goldenPath := flag.String("golden", "", "A file of ip,country_code lines the location mmdb files must agree with before they are used")
+	networksIndex := flag.Bool("networks-index", false, "Index the networks of the first location mmdb at load time to answer /v1/networks")
+	ispNamesPath := flag.String("isp-names", "", "A CSV or JSON file of ISP name translations merged over the built-in ones")
+	placeNamesPath := flag.String("place-names", "", "A CSV or JSON file of place names by geoname ID, for the languages the databases lack them in")
+	overridesPath := flag.String("overrides", "", "A CSV or JSON file of per-network corrections to the mmdb answers")
 	flag.Parse()
 
+	if len(mmdbPaths) == 0 {
+		mmdbPaths = listFlag{"./dbip-full.mmdb"}
+	}
+
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	f, err := os.Open(*mmdb)
-	if err != nil {
+	if err := registerDBTypes(); err != nil {
 		errorLog.Fatal(err)
 	}
-	h := md5.New()
-	if _, err := io.Copy(h, f); err != nil {
-		f.Close()
-		errorLog.Fatal(err)
+	for _, spec := range langFallbacks {
+		if err := internal.SetLanguageFallback(spec); err != nil {
+			errorLog.Fatal(err)
+		}
 	}
-	sum := h.Sum(nil)
-	f.Close()
 
-	db, err := internal.NewDB(*mmdb)
+	var golden *internal.Golden
+	if *goldenPath != "" {
+		var err error
+		golden, err = internal.NewGolden(*goldenPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// before the databases, whose ISPs they name
+	var ispNames *internal.ISPNames
+	var ispNamesSum []byte
+	if *ispNamesPath != "" {
+		var err error
+		ispNamesSum, err = fileSum(*ispNamesPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		ispNames, err = internal.NewISPNames(*ispNamesPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	var placeNames *internal.PlaceNames
+	var placeNamesSum []byte
+	if *placeNamesPath != "" {
+		var err error
+		placeNamesSum, err = fileSum(*placeNamesPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		placeNames, err = internal.NewPlaceNames(*placeNamesPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	var sources []*internal.Source
+	for _, spec := range mmdbPaths {
+		source, err := internal.ParseSource(spec)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		source.Options.InMemory = *inMemory
+		if source.Role == internal.RoleLocation {
+			source.Options.Golden = golden
+		}
+		sources = append(sources, source)
+	}
+
+	var db internal.Locator
+	var merged *internal.Merged
+	var files []*watchedFile
+	var err error
+	switch {
+	case len(sources) == 1 && internal.IsCSVDB(sources[0].Path):
+		db, files, err = openCSVDB(sources[0], golden)
+	case len(sources) == 1 && internal.IsXDB(sources[0].Path):
+		db, files, err = openXDB(sources[0], *inMemory, golden)
+	case len(sources) == 1 && internal.IsQQWry(sources[0].Path):
+		db, files, err = openQQWry(sources[0], golden)
+	default:
+		merged, files, err = openMMDBs(sources, *cacheSize)
+		db = merged
+	}
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 	defer db.Close()
 
+	if ispNames != nil {
+		files = append(files, newWatchedFile(ispNames.Path, "isp-names", ispNamesSum, func() error {
+			if err := ispNames.Reload(); err != nil {
+				return err
+			}
+			if merged != nil {
+				merged.FlushCache()
+			}
+			return nil
+		}))
+	}
+
+	if placeNames != nil {
+		files = append(files, newWatchedFile(placeNames.Path, "place-names", placeNamesSum, func() error {
+			if err := placeNames.Reload(); err != nil {
+				return err
+			}
+			if merged != nil {
+				merged.FlushCache()
+			}
+			return nil
+		}))
+	}
+
+	var networks *atomic.Pointer[internal.NetworkIndex]
+	if *networksIndex {
+		networks, err = indexNetworks(merged, files)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	db = internal.WithReserved(db)
+	if *overridesPath != "" {
+		sum, err := fileSum(*overridesPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		overrides, err := internal.NewOverrides(*overridesPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		files = append(files, newWatchedFile(overrides.Path, "overrides", sum, overrides.Reload))
+		db = internal.WithOverrides(db, overrides)
+	}
+	db = internal.WithTunnels(db)
+
 	limiter := internal.NewIPRateLimiter(1, 5)
 
 	watcher, err := fsnotify.NewWatcher()
@@ -58,22 +251,53 @@ func main() {
 	}
 	defer watcher.Close()
 
-	err = watcher.Add(filepath.Dir(*mmdb))
-	if err != nil {
-		errorLog.Fatal(err)
+	watched := make(map[string]bool)
+	for _, f := range files {
+		dir := filepath.Dir(f.path)
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			errorLog.Fatal(err)
+		}
+		watched[dir] = true
+	}
+
+	languages := supportedLanguages(internal.CanonicalLanguage(*defaultLang), merged)
+	tags := make([]language.Tag, len(languages))
+	for i, lang := range languages {
+		tags[i] = language.Make(lang)
 	}
 
 	app := &application{
-		errorLog: errorLog,
-		infoLog:  infoLog,
-		db:       db,
-		limiter:  limiter,
-		mmdbName: filepath.Base(*mmdb),
-		mmdbSum:  sum,
+		errorLog:        errorLog,
+		infoLog:         infoLog,
+		db:              db,
+		merged:          merged,
+		limiter:         limiter,
+		files:           files,
+		languages:       languages,
+		languageMatcher: language.NewMatcher(tags),
+		defaultLanguage: languages[0],
+		networkIndex:    networks,
 	}
 
 	go app.watchAndReload(watcher)
 
+	if *adminAddr != "" {
+		admin := &http.Server{
+			Addr:        *adminAddr,
+			ErrorLog:    errorLog,
+			Handler:     app.adminRoutes(),
+			IdleTimeout: 10 * time.Second,
+			ReadTimeout: 5 * time.Second,
+		}
+		go func() {
+			infoLog.Printf("Starting admin server on %s", *adminAddr)
+			errorLog.Fatal(admin.ListenAndServe())
+		}()
+	}
+
 	srv := &http.Server{
 		Addr:        *addr,
 		ErrorLog:    errorLog,
@@ -86,3 +310,134 @@ func main() {
 	err = srv.ListenAndServe()
 	errorLog.Fatal(err)
 }
+
+// openMMDBs opens the mmdb files of sources and merges them.
+func openMMDBs(sources []*internal.Source, cacheSize int) (*internal.Merged, []*watchedFile, error) {
+	var sums [][]byte
+	for _, source := range sources {
+		if internal.IsCSVDB(source.Path) || internal.IsXDB(source.Path) || internal.IsQQWry(source.Path) {
+			return nil, nil, fmt.Errorf("%s cannot be combined with other databases", source.Path)
+		}
+		sum, err := fileSum(source.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := source.Open(); err != nil {
+			return nil, nil, err
+		}
+		sums = append(sums, sum)
+	}
+
+	merged, err := internal.NewMerged(sources, cacheSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []*watchedFile
+	for i, source := range sources {
+		source := source
+		f := newWatchedFile(source.Path, source.Role+" mmdb", sums[i], func() error {
+			return merged.Reload(source)
+		})
+		f.source = source
+		files = append(files, f)
+	}
+	return merged, files, nil
+}
+
+// openCSVDB loads the CSV release of source, which is served on its own.
+func openCSVDB(source *internal.Source, golden *internal.Golden) (*internal.CSVDB, []*watchedFile, error) {
+	if source.Role != internal.RoleLocation {
+		return nil, nil, fmt.Errorf("%s: a CSV release can only be a location database", source.Path)
+	}
+	sum, err := fileSum(source.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := internal.NewCSVDB(source.Path, golden)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, []*watchedFile{newWatchedFile(db.Path, "csv", sum, db.Reload)}, nil
+}
+
+// openXDB opens the ip2region xdb file of source, which is served on its
+// own.
+func openXDB(source *internal.Source, inMemory bool, golden *internal.Golden) (*internal.XDB, []*watchedFile, error) {
+	if source.Role != internal.RoleLocation {
+		return nil, nil, fmt.Errorf("%s: an xdb file can only be a location database", source.Path)
+	}
+	sum, err := fileSum(source.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := internal.NewXDB(source.Path, inMemory, golden)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, []*watchedFile{newWatchedFile(db.Path, "xdb", sum, db.Reload)}, nil
+}
+
+// openQQWry loads the qqwry.dat file of source, which is served on its own.
+func openQQWry(source *internal.Source, golden *internal.Golden) (*internal.QQWry, []*watchedFile, error) {
+	if source.Role != internal.RoleLocation {
+		return nil, nil, fmt.Errorf("%s: a qqwry file can only be a location database", source.Path)
+	}
+	sum, err := fileSum(source.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := internal.NewQQWry(source.Path, golden)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, []*watchedFile{newWatchedFile(db.Path, "qqwry", sum, db.Reload)}, nil
+}
+
+// indexNetworks indexes the networks of the first location database of
+// merged, and again every time its file, the ISP names or the place names
+// are reloaded.
+func indexNetworks(merged *internal.Merged, files []*watchedFile) (*atomic.Pointer[internal.NetworkIndex], error) {
+	if merged == nil {
+		return nil, errors.New("reverse queries need an mmdb location database")
+	}
+	var source *internal.Source
+	for _, s := range merged.Sources() {
+		if s.Role == internal.RoleLocation {
+			source = s
+			break
+		}
+	}
+
+	networks := new(atomic.Pointer[internal.NetworkIndex])
+	index := func() error {
+		reader, release, err := source.Acquire()
+		if err != nil {
+			return err
+		}
+		// indexing walks the whole file, which a reload must not close
+		defer release()
+		index, err := internal.NewNetworkIndex(reader)
+		if err != nil {
+			return err
+		}
+		networks.Store(index)
+		return nil
+	}
+	if err := index(); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.source != source && f.kind != "isp-names" && f.kind != "place-names" {
+			continue
+		}
+		reload := f.reload
+		f.reload = func() error {
+			if err := reload(); err != nil {
+				return err
+			}
+			return index()
+		}
+	}
+	return networks, nil
+}
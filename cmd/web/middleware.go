@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+
+	"golang.org/x/text/language"
 )
 
 func (app *application) logRequest(next http.Handler) http.Handler {
@@ -67,3 +70,41 @@ func (app *application) setupCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// negotiateLanguage resolves the language of the answer: the lang query
+// parameter, else a /{lang}/ path prefix, which is stripped, else the
+// Accept-Language header, else the default language. Each of them is
+// matched against the languages the server knows, so that zh, zh-Hant or
+// en-US pick the same language wherever they are given.
+func (app *application) negotiateLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := ""
+		if v := r.URL.Query().Get("lang"); v != "" {
+			if tag, err := language.Parse(v); err == nil {
+				lang, _ = app.matchLanguage(tag)
+			}
+		}
+		segment, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if tag, err := language.Parse(segment); segment != "" && err == nil {
+			if prefixed, ok := app.matchLanguage(tag); ok {
+				if lang == "" {
+					lang = prefixed
+				}
+				r.URL.Path = "/" + rest
+				r.URL.RawPath = ""
+			}
+		}
+		if lang == "" {
+			if tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); err == nil && len(tags) > 0 {
+				lang, _ = app.matchLanguage(tags...)
+			}
+		}
+		if lang == "" {
+			lang = app.defaultLanguage
+		}
+
+		w.Header().Set("Content-Language", lang)
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), languageContextKey, lang)))
+	})
+}
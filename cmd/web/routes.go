@@ -7,9 +7,22 @@ func (app *application) routes() http.Handler {
 
 	mux.Handle("/", app.limitRequest(http.HandlerFunc(app.home)))
 	mux.Handle("/v1/report", app.setupCORS(http.HandlerFunc(app.report)))
+	mux.Handle("/v1/meta", app.setupCORS(http.HandlerFunc(app.meta)))
+	mux.Handle("/v1/networks", app.setupCORS(http.HandlerFunc(app.networks)))
 
 	fileServer := http.FileServer(http.Dir("./download/"))
 	mux.Handle("/v1/download/", http.StripPrefix("/v1/download", fileServer))
 
-	return app.recoverPanic(app.logRequest(app.redirectTrailingSlash(mux)))
+	return app.recoverPanic(app.logRequest(app.redirectTrailingSlash(app.negotiateLanguage(mux))))
+}
+
+// adminRoutes serves the endpoints meant for the operators, on a listener of
+// their own so that they are not exposed along with the public API.
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1/cache", app.cacheStats)
+	mux.HandleFunc("/v1/untranslated", app.untranslated)
+
+	return app.recoverPanic(app.logRequest(mux))
 }
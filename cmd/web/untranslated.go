@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuryqwer/ip2loc/internal"
+)
+
+// runUntranslated is the untranslated subcommand, which asks a running
+// server for the most queried places it answered in another language than
+// the one asked for. The output is a CSV file in the format of -place-names
+// with an empty name column, so that translating a place is filling in its
+// name and appending the row to the place names.
+func runUntranslated(args []string) error {
+	flags := flag.NewFlagSet("untranslated", flag.ExitOnError)
+	server := flags.String("server", "http://localhost:4001", "The URL of the admin endpoints of the server, as given by its -admin-addr")
+	lang := flags.String("lang", "", "The language to report, or all; the default language of the server when empty")
+	limit := flags.Int("n", 100, "How many places to report")
+	flags.Parse(args)
+
+	query := url.Values{"limit": {strconv.Itoa(*limit)}}
+	if *lang != "" {
+		query.Set("lang", *lang)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(*server, "/") + "/v1/untranslated?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("%s: %w", resp.Request.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var msg struct {
+			Msg string `json:"msg"`
+		}
+		json.Unmarshal(body.Data, &msg)
+		return fmt.Errorf("%s: %s %s", resp.Request.URL, resp.Status, msg.Msg)
+	}
+	var places []internal.UntranslatedPlace
+	if err := json.Unmarshal(body.Data, &places); err != nil {
+		return fmt.Errorf("%s: %w", resp.Request.URL, err)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"geoname_id", "lang", "name", "field", "queries", "answered", "answered_lang"})
+	for _, place := range places {
+		w.Write([]string{
+			strconv.FormatUint(uint64(place.GeoNameID), 10),
+			place.Lang,
+			"",
+			place.Field,
+			strconv.FormatUint(place.Queries, 10),
+			place.Name,
+			place.NameLang,
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -1,16 +1,26 @@
 module github.com/yuryqwer/ip2loc
 
-go 1.20
+go 1.21
 
 replace github.com/oschwald/geoip2-golang v1.9.0 => ./internal/geoip2-golang
 
 require (
 	github.com/fsnotify/fsnotify v1.6.0
 	github.com/oschwald/geoip2-golang v1.9.0
+	github.com/parquet-go/parquet-go v0.23.0
+	golang.org/x/text v0.14.0
 	golang.org/x/time v0.3.0
 )
 
 require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/olekukonko/tablewriter v0.0.5 // indirect
 	github.com/oschwald/maxminddb-golang v1.11.0 // indirect
-	golang.org/x/sys v0.9.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	github.com/segmentio/encoding v0.4.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
 )
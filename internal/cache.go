@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"container/list"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+)
+
+type cacheKey struct {
+	network netip.Prefix
+	lang    string
+	// record is set for the Records of Merged.Lookup, which are cached
+	// along with the IPInfos.
+	record bool
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value any
+}
+
+// cacheGeneration is the content of an IPInfoCache between two flushes.
+type cacheGeneration struct {
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+// IPInfoCache is a size-bounded cache of localized answers and of the
+// records they come from, keyed by the network they were found under
+// rather than by address, so that one entry serves a whole /24 or /48. The
+// least recently used entry is evicted when it is full.
+type IPInfoCache struct {
+	size       int
+	generation atomic.Pointer[cacheGeneration]
+	hits       atomic.Uint64
+	misses     atomic.Uint64
+}
+
+// CacheStats is a snapshot of the counters of an IPInfoCache.
+type CacheStats struct {
+	Size    int    `json:"size"`
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// NewIPInfoCache returns a cache of at most size entries.
+func NewIPInfoCache(size int) *IPInfoCache {
+	c := &IPInfoCache{size: size}
+	c.Flush()
+	return c
+}
+
+// Flush empties the cache at once. Answers being computed from a database
+// that was just replaced end up in the discarded generation, provided the
+// generation was loaded before the database was read.
+func (c *IPInfoCache) Flush() {
+	c.generation.Store(&cacheGeneration{
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	})
+}
+
+// Stats returns the counters of the cache. Hits and misses are counted
+// since the cache was created, across flushes.
+func (c *IPInfoCache) Stats() CacheStats {
+	g := c.generation.Load()
+	g.mu.Lock()
+	entries := g.lru.Len()
+	g.mu.Unlock()
+	return CacheStats{
+		Size:    c.size,
+		Entries: entries,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+	}
+}
+
+func (c *IPInfoCache) current() *cacheGeneration {
+	return c.generation.Load()
+}
+
+func (c *IPInfoCache) get(g *cacheGeneration, key cacheKey) (any, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	elem, ok := g.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	g.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+func (c *IPInfoCache) add(g *cacheGeneration, key cacheKey, value any) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if elem, ok := g.entries[key]; ok {
+		elem.Value.(*cacheEntry).value = value
+		g.lru.MoveToFront(elem)
+		return
+	}
+	g.entries[key] = g.lru.PushFront(&cacheEntry{key: key, value: value})
+	if g.lru.Len() > c.size {
+		oldest := g.lru.Back()
+		g.lru.Remove(oldest)
+		delete(g.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"net/netip"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func testCacheKey(network string) cacheKey {
+	return cacheKey{network: netip.MustParsePrefix(network), lang: "en"}
+}
+
+func TestIPInfoCacheEviction(t *testing.T) {
+	c := NewIPInfoCache(2)
+	a, b, d := testCacheKey("1.0.0.0/24"), testCacheKey("1.0.1.0/24"), testCacheKey("1.0.2.0/24")
+	g := c.current()
+	c.add(g, a, "a")
+	c.add(g, b, "b")
+	// a is now the most recently used, so adding d evicts b
+	if v, ok := c.get(g, a); !ok || v != "a" {
+		t.Fatalf("a = %v, %v", v, ok)
+	}
+	c.add(g, d, "d")
+	if _, ok := c.get(g, b); ok {
+		t.Error("b was not evicted")
+	}
+	for key, want := range map[cacheKey]string{a: "a", d: "d"} {
+		if v, ok := c.get(g, key); !ok || v != want {
+			t.Errorf("%s = %v, %v, want %s", key.network, v, ok, want)
+		}
+	}
+
+	// replacing an entry makes it the most recently used without growing
+	// the cache
+	c.add(g, a, "a2")
+	c.add(g, b, "b")
+	if v, ok := c.get(g, a); !ok || v != "a2" {
+		t.Errorf("a = %v, %v, want a2", v, ok)
+	}
+	if _, ok := c.get(g, d); ok {
+		t.Error("d was not evicted")
+	}
+	if entries := c.Stats().Entries; entries != 2 {
+		t.Errorf("%d entries, want 2", entries)
+	}
+
+	// the language and the kind of entry are part of the key
+	for _, key := range []cacheKey{{network: a.network, lang: "zh-CN"}, {network: a.network, record: true}} {
+		if _, ok := c.get(g, key); ok {
+			t.Errorf("%+v answered with the entry of %+v", key, a)
+		}
+	}
+}
+
+func TestIPInfoCacheStats(t *testing.T) {
+	c := NewIPInfoCache(10)
+	key := testCacheKey("1.0.0.0/24")
+	c.get(c.current(), key)
+	c.add(c.current(), key, "a")
+	c.get(c.current(), key)
+	c.get(c.current(), key)
+	if stats := c.Stats(); stats != (CacheStats{Size: 10, Entries: 1, Hits: 2, Misses: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	// flushing empties the cache but keeps the counters
+	c.Flush()
+	c.get(c.current(), key)
+	if stats := c.Stats(); stats != (CacheStats{Size: 10, Entries: 0, Hits: 2, Misses: 2}) {
+		t.Errorf("stats after a flush = %+v", stats)
+	}
+}
+
+func TestIPInfoCacheFlush(t *testing.T) {
+	c := NewIPInfoCache(10)
+	key := testCacheKey("1.0.0.0/24")
+	// an answer computed from the database a flush discards lands in the
+	// generation it was loaded with
+	g := c.current()
+	c.Flush()
+	c.add(g, key, "stale")
+	if v, ok := c.get(c.current(), key); ok {
+		t.Errorf("the flushed generation answered %v", v)
+	}
+}
+
+// TestIPInfoCacheFlushRace replaces the database, a counter here, and
+// flushes the cache while answers are being added, the way Merged and its
+// sources do. Answers load the generation before the database, so none
+// computed from a replaced database may be left after the last flush.
+func TestIPInfoCacheFlushRace(t *testing.T) {
+	c := NewIPInfoCache(1000)
+	var database atomic.Int64
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				g := c.current()
+				// widen the window for a reload between the two loads
+				runtime.Gosched()
+				answer := database.Load()
+				key := testCacheKey(fmt.Sprintf("10.%d.%d.0/24", i, n%256))
+				if _, ok := c.get(g, key); !ok {
+					c.add(g, key, answer)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 1000; i++ {
+		database.Add(1)
+		c.Flush()
+		runtime.Gosched()
+	}
+	close(done)
+	wg.Wait()
+
+	last := database.Load()
+	g := c.current()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, elem := range g.entries {
+		if v := elem.Value.(*cacheEntry).value.(int64); v != last {
+			t.Errorf("%s holds the answer of database %d, the last is %d", key.network, v, last)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// The columns of a dbip's `IP to Location + ISP` CSV release.
+const (
+	csvIPStart = iota
+	csvIPEnd
+	csvContinent
+	csvCountry
+	csvStateProv
+	csvDistrict
+	csvCity
+	csvZipCode
+	csvLatitude
+	csvLongitude
+	csvGeoNameID
+	csvTimeZoneOffset
+	csvTimeZoneName
+	csvWeatherCode
+	csvISPName
+	csvASNumber
+	csvConnectionType
+	csvOrganizationName
+	// csvUserType is not in the releases but may be added by hand, with the
+	// values of the user_type of the mmdb.
+	csvUserType
+
+	csvMinColumns = csvOrganizationName + 1
+)
+
+var continentNames = map[string]map[string]string{
+	"AF": {"en": "Africa", "zh-CN": "非洲"},
+	"AN": {"en": "Antarctica", "zh-CN": "南极洲"},
+	"AS": {"en": "Asia", "zh-CN": "亚洲"},
+	"EU": {"en": "Europe", "zh-CN": "欧洲"},
+	"NA": {"en": "North America", "zh-CN": "北美洲"},
+	"OC": {"en": "Oceania", "zh-CN": "大洋洲"},
+	"SA": {"en": "South America", "zh-CN": "南美洲"},
+}
+
+var zhCNRegions = display.Regions(language.SimplifiedChinese)
+
+// countryNames returns the names of the country with the iso code, which
+// the CSV releases do not carry.
+func countryNames(code string) map[string]string {
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return nil
+	}
+	return map[string]string{
+		"en":    display.English.Regions().Name(region),
+		"zh-CN": zhCNRegions.Name(region),
+	}
+}
+
+// csvRecord is a row of the CSV without its range. Rows with the same
+// content share one csvRecord.
+type csvRecord struct {
+	continent, country, stateProv, district, city string
+	zipCode, timeZone, weatherCode                string
+	isp, connectionType, organization, userType   string
+	latitude, longitude                           float64
+	geoNameID, asn                                uint32
+}
+
+func (r *csvRecord) toRecord() *Record {
+	var record Record
+	record.Continent.Code = r.continent
+	record.Continent.Names = continentNames[r.continent]
+	record.Country.IsoCode = r.country
+	record.Country.Names = countryNames(r.country)
+	record.City.GeoNameID = uint(r.geoNameID)
+	if r.city != "" {
+		record.City.Names = map[string]string{"en": r.city}
+	}
+	record.Location.Latitude = r.latitude
+	record.Location.Longitude = r.longitude
+	record.Location.TimeZone = r.timeZone
+	record.Location.WeatherCode = r.weatherCode
+	record.Postal.Code = r.zipCode
+	// the district is where the mmdb keeps the city IPInfo answers with
+	record.Subdivisions = subdivisionsOf("en", r.stateProv, r.district)
+	record.Traits.ISP = r.isp
+	record.Traits.ConnectionType = r.connectionType
+	record.Traits.Organization = r.organization
+	record.Traits.UserType = r.userType
+	record.Traits.AutonomousSystemNumber = uint(r.asn)
+	record.Traits.AutonomousSystemOrganization = r.organization
+	return &record
+}
+
+// subdivision is the type of the elements of Record.Subdivisions.
+type subdivision = struct {
+	GeoNameID uint              `maxminddb:"geoname_id" json:"geoname_id"`
+	IsoCode   string            `maxminddb:"iso_code" json:"iso_code"`
+	Names     map[string]string `maxminddb:"names" json:"names"`
+}
+
+// subdivisionsOf returns subdivisions with names in lang, up to the last
+// name that is not empty, since IPInfo takes the city from the second one.
+func subdivisionsOf(lang string, names ...string) []subdivision {
+	for len(names) > 0 && names[len(names)-1] == "" {
+		names = names[:len(names)-1]
+	}
+	subdivisions := make([]subdivision, len(names))
+	for i, name := range names {
+		if name != "" {
+			subdivisions[i].Names = map[string]string{lang: name}
+		}
+	}
+	return subdivisions
+}
+
+type csvRange4 struct {
+	start, end uint32
+	record     uint32
+}
+
+type csvRange6 struct {
+	start, end [16]byte
+	record     uint32
+}
+
+// csvIndex holds the ranges of a CSV sorted by start address, IPv4 ones
+// apart so that they take 12 bytes each.
+type csvIndex struct {
+	v4      []csvRange4
+	v6      []csvRange6
+	records []csvRecord
+	// modTime is when the file was written, the CSV having no build date.
+	modTime time.Time
+}
+
+func (index *csvIndex) lookup(addr netip.Addr) (*csvRecord, netip.Prefix) {
+	addr = addr.Unmap()
+	if addr.Is4() {
+		a4 := addr.As4()
+		ip := binary.BigEndian.Uint32(a4[:])
+		i := sort.Search(len(index.v4), func(i int) bool { return index.v4[i].end >= ip })
+		if i < len(index.v4) && index.v4[i].start <= ip {
+			r := index.v4[i]
+			return &index.records[r.record], rangePrefix(netip.AddrFrom4(uint32Bytes(r.start)), netip.AddrFrom4(uint32Bytes(r.end)), addr)
+		}
+		return nil, netip.Prefix{}
+	}
+	ip := addr.As16()
+	i := sort.Search(len(index.v6), func(i int) bool {
+		return bytes.Compare(index.v6[i].end[:], ip[:]) >= 0
+	})
+	if i < len(index.v6) && bytes.Compare(index.v6[i].start[:], ip[:]) <= 0 {
+		r := index.v6[i]
+		return &index.records[r.record], rangePrefix(netip.AddrFrom16(r.start), netip.AddrFrom16(r.end), addr)
+	}
+	return nil, netip.Prefix{}
+}
+
+// CSVDB is the Locator backed by a dbip's `IP to Location + ISP` CSV
+// release, possibly gzipped, loaded into memory. Names are English only,
+// except for the continent and the country which are known in zh-CN too.
+//
+// The rows are ip_start, ip_end, continent, country, stateprov, district,
+// city, zipcode, latitude, longitude, geoname_id, timezone_offset,
+// timezone_name, weather_code, isp_name, as_number, connection_type and
+// organization_name, optionally followed by a user_type as found in the
+// mmdb. Lines starting with # are comments.
+type CSVDB struct {
+	Path string
+	// Golden, when set, holds assertions the file must pass to be loaded.
+	Golden *Golden
+	index  atomic.Pointer[csvIndex]
+}
+
+func NewCSVDB(path string, golden *Golden) (*CSVDB, error) {
+	db := &CSVDB{Path: path, Golden: golden}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// IsCSVDB reports whether path names a CSV release by its extension.
+func IsCSVDB(path string) bool {
+	path = strings.ToLower(path)
+	return strings.HasSuffix(path, ".csv") || strings.HasSuffix(path, ".csv.gz")
+}
+
+// Reload reads the file again. The ranges in use are kept if it cannot be
+// read, has overlapping ranges or fails the assertions of db.Golden.
+func (db *CSVDB) Reload() error {
+	f, err := os.Open(db.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(strings.ToLower(db.Path), ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	index, err := readCSVIndex(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", db.Path, err)
+	}
+	if info, err := f.Stat(); err == nil {
+		index.modTime = info.ModTime()
+	}
+	if db.Golden != nil {
+		candidate := &CSVDB{Path: db.Path}
+		candidate.index.Store(index)
+		if err := db.Golden.Check(candidate); err != nil {
+			return fmt.Errorf("%s failed verification: %w", db.Path, err)
+		}
+	}
+	db.index.Store(index)
+	return nil
+}
+
+func readCSVIndex(r io.Reader) (*csvIndex, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	index := &csvIndex{}
+	records := make(map[csvRecord]uint32)
+	strs := make(map[string]string)
+	intern := func(s string) string {
+		if v, ok := strs[s]; ok {
+			return v
+		}
+		s = strings.Clone(s)
+		strs[s] = s
+		return s
+	}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) < csvMinColumns {
+			return nil, fmt.Errorf("line %d: %d columns instead of %d", line, len(row), csvMinColumns)
+		}
+		start, err := netip.ParseAddr(row[csvIPStart])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(row[csvIPEnd])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		start, end = start.Unmap(), end.Unmap()
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("line %d: invalid range %s-%s", line, start, end)
+		}
+		record, err := newCSVRecord(row, intern)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		i, ok := records[record]
+		if !ok {
+			i = uint32(len(index.records))
+			records[record] = i
+			index.records = append(index.records, record)
+		}
+		if start.Is4() {
+			s, e := start.As4(), end.As4()
+			index.v4 = append(index.v4, csvRange4{
+				start:  binary.BigEndian.Uint32(s[:]),
+				end:    binary.BigEndian.Uint32(e[:]),
+				record: i,
+			})
+		} else {
+			index.v6 = append(index.v6, csvRange6{start: start.As16(), end: end.As16(), record: i})
+		}
+	}
+
+	sort.Slice(index.v4, func(i, j int) bool { return index.v4[i].start < index.v4[j].start })
+	sort.Slice(index.v6, func(i, j int) bool {
+		return bytes.Compare(index.v6[i].start[:], index.v6[j].start[:]) < 0
+	})
+	for i := 1; i < len(index.v4); i++ {
+		if index.v4[i].start <= index.v4[i-1].end {
+			return nil, fmt.Errorf("range starting at %s overlaps the one before",
+				netip.AddrFrom4(uint32Bytes(index.v4[i].start)))
+		}
+	}
+	for i := 1; i < len(index.v6); i++ {
+		if bytes.Compare(index.v6[i].start[:], index.v6[i-1].end[:]) <= 0 {
+			return nil, fmt.Errorf("range starting at %s overlaps the one before",
+				netip.AddrFrom16(index.v6[i].start))
+		}
+	}
+	if len(index.v4)+len(index.v6) == 0 {
+		return nil, errors.New("no ranges")
+	}
+	return index, nil
+}
+
+func uint32Bytes(v uint32) [4]byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return b
+}
+
+func newCSVRecord(row []string, intern func(string) string) (csvRecord, error) {
+	record := csvRecord{
+		continent:      intern(row[csvContinent]),
+		country:        intern(row[csvCountry]),
+		stateProv:      intern(row[csvStateProv]),
+		district:       intern(row[csvDistrict]),
+		city:           intern(row[csvCity]),
+		zipCode:        intern(row[csvZipCode]),
+		timeZone:       intern(row[csvTimeZoneName]),
+		weatherCode:    intern(row[csvWeatherCode]),
+		isp:            intern(row[csvISPName]),
+		connectionType: intern(row[csvConnectionType]),
+		organization:   intern(row[csvOrganizationName]),
+	}
+	if len(row) > csvUserType {
+		record.userType = intern(row[csvUserType])
+	}
+	var err error
+	if row[csvLatitude] != "" {
+		if record.latitude, err = strconv.ParseFloat(row[csvLatitude], 64); err != nil {
+			return record, fmt.Errorf("invalid latitude %q", row[csvLatitude])
+		}
+	}
+	if row[csvLongitude] != "" {
+		if record.longitude, err = strconv.ParseFloat(row[csvLongitude], 64); err != nil {
+			return record, fmt.Errorf("invalid longitude %q", row[csvLongitude])
+		}
+	}
+	if row[csvGeoNameID] != "" {
+		id, err := strconv.ParseUint(row[csvGeoNameID], 10, 32)
+		if err != nil {
+			return record, fmt.Errorf("invalid geoname_id %q", row[csvGeoNameID])
+		}
+		record.geoNameID = uint32(id)
+	}
+	if row[csvASNumber] != "" {
+		asn, err := strconv.ParseUint(row[csvASNumber], 10, 32)
+		if err != nil {
+			return record, fmt.Errorf("invalid as_number %q", row[csvASNumber])
+		}
+		record.asn = uint32(asn)
+	}
+	return record, nil
+}
+
+// Lookup returns the record of addr. Addresses outside of every range get
+// an empty record, as with an mmdb.
+func (db *CSVDB) Lookup(addr netip.Addr) (*Record, error) {
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("%s is not a valid ip address", addr)
+	}
+	record, network := db.index.Load().lookup(addr)
+	if record == nil {
+		return &Record{}, nil
+	}
+	result := record.toRecord()
+	result.Traits.Network = network.String()
+	return result, nil
+}
+
+func (db *CSVDB) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	record, err := db.Lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	return GetIPInfoFromLocationISP(record, lang), nil
+}
+
+// Databases describes the file, dated when it was written.
+func (db *CSVDB) Databases() []DatabaseInfo {
+	return []DatabaseInfo{{
+		Role:         RoleLocation,
+		Path:         db.Path,
+		DatabaseType: "DBIP-Location-ISP CSV",
+		BuildEpoch:   uint(db.index.Load().modTime.Unix()),
+		Languages:    []string{"en", "zh-CN"},
+		IPVersion:    6,
+	}}
+}
+
+func (db *CSVDB) Close() error {
+	return nil
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"compress/gzip"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCSV = `# ip_start,ip_end,continent,country,stateprov,district,city,zipcode,latitude,longitude,geoname_id,timezone_offset,timezone_name,weather_code,isp_name,as_number,connection_type,organization_name,user_type
+1.0.1.0,1.0.3.255,AS,CN,Fujian,Fuzhou,Gulou,350001,26.08,119.3,1810821,8,Asia/Shanghai,CHXX0031,China Unicom,4837,cable,China Unicom Fujian,residential
+1.0.0.0,1.0.0.255,AS,CN,Guangdong,Shenzhen,Nanshan,,22.54,114.06,1795565,8,Asia/Shanghai,,China Telecom,4134,,China Telecom
+8.8.8.0,8.8.8.255,NA,US,California,,Mountain View,94043,37.42,-122.08,5375480,-7,America/Los_Angeles,,Google LLC,15169,corporate,Google LLC,hosting
+2400:da00::,2400:da00:ffff:ffff:ffff:ffff:ffff:ffff,AS,CN,Beijing,,Beijing,,39.9,116.4,,8,Asia/Shanghai,,Alibaba,37963,,Alibaba Cloud
+`
+
+func TestReadCSVIndex(t *testing.T) {
+	index, err := readCSVIndex(strings.NewReader(testCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.v4) != 3 || len(index.v6) != 1 {
+		t.Fatalf("%d IPv4 and %d IPv6 ranges, want 3 and 1", len(index.v4), len(index.v6))
+	}
+	if len(index.records) != 4 {
+		t.Errorf("%d records, want 4", len(index.records))
+	}
+
+	tests := []struct {
+		addr    string
+		city    string
+		network string
+	}{
+		{addr: "1.0.0.7", city: "Nanshan", network: "1.0.0.0/24"},
+		{addr: "1.0.1.5", city: "Gulou", network: "1.0.1.0/24"},
+		{addr: "1.0.2.1", city: "Gulou", network: "1.0.2.0/23"},
+		{addr: "::ffff:8.8.8.8", city: "Mountain View", network: "8.8.8.0/24"},
+		{addr: "2400:da00::1", city: "Beijing", network: "2400:da00::/32"},
+		{addr: "0.1.2.3"},
+		{addr: "1.0.4.0"},
+		{addr: "2400:db00::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			record, network := index.lookup(netip.MustParseAddr(tt.addr))
+			if (record != nil) != (tt.city != "") {
+				t.Fatalf("record = %+v, want city %q", record, tt.city)
+			}
+			if record == nil {
+				return
+			}
+			if record.city != tt.city || network.String() != tt.network {
+				t.Errorf("got %s %s, want %s %s", record.city, network, tt.city, tt.network)
+			}
+		})
+	}
+}
+
+func TestReadCSVIndexInvalid(t *testing.T) {
+	const row = ",AS,CN,,,,,,,,,,,,,,"
+	tests := []struct {
+		name string
+		csv  string
+		err  string
+	}{
+		{name: "empty", csv: "# nothing\n", err: "no ranges"},
+		{name: "columns", csv: "1.0.0.0,1.0.0.255,AS,CN\n", err: "line 1: 4 columns"},
+		{name: "address", csv: "1.0.0,1.0.0.255" + row + "\n", err: "line 1:"},
+		{name: "reversed", csv: "1.0.0.255,1.0.0.0" + row + "\n", err: "invalid range"},
+		{name: "mixed", csv: "1.0.0.0,::1" + row + "\n", err: "invalid range"},
+		{name: "latitude", csv: "1.0.0.0,1.0.0.255,AS,CN,,,,,north,,,,,,,,,\n", err: `invalid latitude "north"`},
+		{name: "geoname_id", csv: "1.0.0.0,1.0.0.255,AS,CN,,,,,,,-1,,,,,,,\n", err: `invalid geoname_id "-1"`},
+		{name: "as_number", csv: "1.0.0.0,1.0.0.255,AS,CN,,,,,,,,,,,,AS1,,\n", err: `invalid as_number "AS1"`},
+		{name: "overlap", csv: "1.0.0.0,1.0.0.255" + row + "\n1.0.0.128,1.0.1.0" + row + "\n", err: "1.0.0.128 overlaps"},
+		{name: "overlap v6", csv: "::1:0,::1:ffff" + row + "\n::1:ff00,::2:0" + row + "\n", err: "::1:ff00 overlaps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readCSVIndex(strings.NewReader(tt.csv))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCSVRecord(t *testing.T) {
+	index, err := readCSVIndex(strings.NewReader(testCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr         string
+		country      string
+		continent    string
+		subdivisions []string
+		userType     string
+		asn          uint
+	}{
+		{addr: "1.0.1.1", country: "中国", continent: "亚洲", subdivisions: []string{"Fujian", "Fuzhou"}, userType: "residential", asn: 4837},
+		{addr: "8.8.8.8", country: "美国", continent: "北美洲", subdivisions: []string{"California"}, userType: "hosting", asn: 15169},
+		{addr: "1.0.0.1", country: "中国", continent: "亚洲", subdivisions: []string{"Guangdong", "Shenzhen"}, asn: 4134},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			r, _ := index.lookup(netip.MustParseAddr(tt.addr))
+			record := r.toRecord()
+			if got := record.Country.Names["zh-CN"]; got != tt.country {
+				t.Errorf("country = %q, want %q", got, tt.country)
+			}
+			if got := record.Continent.Names["zh-CN"]; got != tt.continent {
+				t.Errorf("continent = %q, want %q", got, tt.continent)
+			}
+			var subdivisions []string
+			for _, s := range record.Subdivisions {
+				subdivisions = append(subdivisions, s.Names["en"])
+			}
+			if strings.Join(subdivisions, ",") != strings.Join(tt.subdivisions, ",") {
+				t.Errorf("subdivisions = %q, want %q", subdivisions, tt.subdivisions)
+			}
+			if record.Traits.UserType != tt.userType || record.Traits.AutonomousSystemNumber != tt.asn {
+				t.Errorf("user type, asn = %q, %d, want %q, %d",
+					record.Traits.UserType, record.Traits.AutonomousSystemNumber, tt.userType, tt.asn)
+			}
+		})
+	}
+}
+
+func TestCSVDBGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbip.csv.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write([]byte(testCSV)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := NewCSVDB(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := db.LookupIPInfo(netip.MustParseAddr("8.8.8.8"), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Country != "United States" || info.Region != "California" || info.ISP != "Google LLC" {
+		t.Errorf("info = %+v", info)
+	}
+	if databases := db.Databases(); len(databases) != 1 || databases[0].BuildEpoch == 0 {
+		t.Errorf("databases = %+v", databases)
+	}
+}
@@ -1,9 +1,13 @@
 package internal
 
 import (
+	"flag"
 	"fmt"
+	"math/big"
 	"net"
+	"net/netip"
 	"strings"
+	"sync"
 
 	"github.com/oschwald/geoip2-golang"
 )
@@ -154,7 +158,61 @@ var ispName = map[string]string{
 }
 
 func NewDB(mmdb string) (*geoip2.Reader, error) {
-	return geoip2.Open(mmdb)
+	return OpenDB(mmdb, OpenOptions{})
+}
+
+// RegisterDatabaseType registers a database type given as
+// `database_type=Method,Method`, where the methods are the lookup methods of
+// geoip2.Reader the type supports, such as LocationISP, City or ASN. The
+// database type is split at the last `=`, as DB-IP types contain one.
+func RegisterDatabaseType(spec string) error {
+	i := strings.LastIndex(spec, "=")
+	if i < 0 {
+		return fmt.Errorf("%s is not in the form database_type=Method,Method", spec)
+	}
+	var methods []string
+	for _, method := range strings.Split(spec[i+1:], ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			methods = append(methods, method)
+		}
+	}
+	return geoip2.RegisterDatabaseType(spec[:i], methods...)
+}
+
+// databaseTypeSpecs collects the values of a repeated -dbtype flag.
+type databaseTypeSpecs []string
+
+func (s *databaseTypeSpecs) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *databaseTypeSpecs) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// DatabaseTypeFlags defines the -dbtype and -detect-dbtype flags on flags,
+// for the commands that open mmdb files. The returned function registers
+// the database types they give, and is to be called once flags are parsed.
+func DatabaseTypeFlags(flags *flag.FlagSet) func() error {
+	var specs databaseTypeSpecs
+	flags.Var(&specs, "dbtype", "A custom mmdb database type, as database_type=Method,Method with the geoip2.Reader methods it supports; may be repeated")
+	detect := flags.Bool("detect-dbtype", false, "Guess the lookup methods of unknown mmdb database types from their records")
+	return func() error {
+		for _, spec := range specs {
+			if err := RegisterDatabaseType(spec); err != nil {
+				return err
+			}
+		}
+		DetectUnknownDatabaseTypes(*detect)
+		return nil
+	}
+}
+
+// DetectUnknownDatabaseTypes sets whether databases of a type that is not
+// known are opened anyway, with the lookup methods their records suggest.
+func DetectUnknownDatabaseTypes(enable bool) {
+	geoip2.DetectUnknownDatabaseTypes(enable)
 }
 
 func GetIPInfo(targetIP string, db *geoip2.Reader) (*geoip2.LocationISP, error) {
@@ -165,6 +223,56 @@ func GetIPInfo(targetIP string, db *geoip2.Reader) (*geoip2.LocationISP, error)
 	return db.LocationISP(ip)
 }
 
+// GetIPInfoByAddr is like GetIPInfo but takes an already parsed address,
+// so callers that validated the ip do not pay for parsing it twice.
+func GetIPInfoByAddr(addr netip.Addr, db *geoip2.Reader) (*geoip2.LocationISP, error) {
+	info, network, err := db.LocationISPAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network.IsValid() {
+		info.Traits.Network = network.String()
+	}
+	return info, nil
+}
+
+var compactPool = sync.Pool{
+	New: func() any { return new(geoip2.CompactLocationISP) },
+}
+
+// LookupIPInfo returns the localized info of addr. It decodes only the
+// fields IPInfo needs into a pooled record, which is much cheaper than
+// GetIPInfoByAddr followed by GetIPInfoFromLocationISP, unless names in
+// languages other than en and zh-CN may be needed: when lang may be
+// answered in one of them, or when a place has no name in either.
+func LookupIPInfo(addr netip.Addr, db *geoip2.Reader, lang string) (*IPInfo, error) {
+	if !compactChain(languageChain(lang), db.Metadata().Languages) {
+		return lookupFullIPInfo(addr, db, lang)
+	}
+
+	info := compactPool.Get().(*geoip2.CompactLocationISP)
+	defer compactPool.Put(info)
+
+	network, err := db.CompactLocationISP(addr, info)
+	if err != nil {
+		return nil, err
+	}
+	ipInfo := GetIPInfoFromCompact(info, lang)
+	if compactUnnamed(info, ipInfo) {
+		return lookupFullIPInfo(addr, db, lang)
+	}
+	ipInfo.Network = newNetworkRange(network)
+	return ipInfo, nil
+}
+
+func lookupFullIPInfo(addr netip.Addr, db *geoip2.Reader, lang string) (*IPInfo, error) {
+	record, err := GetIPInfoByAddr(addr, db)
+	if err != nil {
+		return nil, err
+	}
+	return GetIPInfoFromLocationISP(record, lang), nil
+}
+
 type IPInfo struct {
 	Continent     string  `json:"continent"`
 	ContinentCode string  `json:"continent_code"`
@@ -179,6 +287,77 @@ type IPInfo struct {
 	Longitude     float64 `json:"longitude"`
 	ISP           string  `json:"isp"`
 	UserType      string  `json:"user_type"`
+
+	// Network is the range of addresses that get this same answer, nil
+	// when it is not known.
+	Network *NetworkRange `json:"network,omitempty"`
+	// Tunnel is set when the address asked for is an IPv6 transition
+	// address, whose embedded IPv4 address the rest of the info is about.
+	Tunnel *Tunnel `json:"tunnel,omitempty"`
+	// Reserved is set for the addresses of special-purpose ranges, which
+	// have no location.
+	Reserved *ReservedRange `json:"reserved,omitempty"`
+
+	ASN            uint       `json:"asn,omitempty"`
+	ASOrganization string     `json:"as_organization,omitempty"`
+	Anonymous      *Anonymous `json:"anonymous,omitempty"`
+
+	// Languages tells the language each name is in.
+	Languages FieldLanguages `json:"languages"`
+
+	// Overridden names the fields that come from local overrides rather
+	// than from the databases.
+	Overridden []string `json:"overridden,omitempty"`
+
+	// untranslated are the places answered in another language than the
+	// one asked for, for the untranslated report.
+	untranslated []UntranslatedPlace
+}
+
+// NetworkRange describes the network an answer was found under, so that
+// clients can cache answers by range. AddressCount is a decimal string
+// since IPv6 networks hold more addresses than a JSON number can carry.
+type NetworkRange struct {
+	CIDR         string `json:"cidr"`
+	PrefixLength int    `json:"prefix_length"`
+	First        string `json:"first"`
+	Last         string `json:"last"`
+	AddressCount string `json:"address_count"`
+}
+
+func newNetworkRange(prefix netip.Prefix) *NetworkRange {
+	if !prefix.IsValid() {
+		return nil
+	}
+	prefix = prefix.Masked()
+	count := new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+	return &NetworkRange{
+		CIDR:         prefix.String(),
+		PrefixLength: prefix.Bits(),
+		First:        prefix.Addr().String(),
+		Last:         LastAddr(prefix).String(),
+		AddressCount: count.String(),
+	}
+}
+
+// prefix returns the network r describes.
+func (r *NetworkRange) prefix() netip.Prefix {
+	if r == nil {
+		return netip.Prefix{}
+	}
+	prefix, _ := netip.ParsePrefix(r.CIDR)
+	return prefix
+}
+
+// Anonymous holds the anonymizer flags of an address, as found in an
+// anonymous-IP database.
+type Anonymous struct {
+	IsAnonymous        bool `json:"is_anonymous"`
+	IsAnonymousVPN     bool `json:"is_anonymous_vpn"`
+	IsHostingProvider  bool `json:"is_hosting_provider"`
+	IsPublicProxy      bool `json:"is_public_proxy"`
+	IsResidentialProxy bool `json:"is_residential_proxy"`
+	IsTorExitNode      bool `json:"is_tor_exit_node"`
 }
 
 func GetIPInfoFromLocationISP(info *geoip2.LocationISP, lang string) *IPInfo {
@@ -190,99 +369,174 @@ func GetIPInfoFromLocationISP(info *geoip2.LocationISP, lang string) *IPInfo {
 		Latitude:      info.Location.Latitude,
 		Longitude:     info.Location.Longitude,
 	}
-	// language
-	var secondLang string
-	if lang == "en" {
-		secondLang = "zh-CN"
-	} else if lang == "zh-CN" {
-		secondLang = "en"
-	} else {
-		lang = "zh-CN"
-		secondLang = "en"
+	chain := languageChain(lang)
+	ipInfo.ISP, ipInfo.Languages.ISP = chainISP(info.Traits.ISP, chain)
+	ipInfo.Continent, ipInfo.Languages.Continent = localizedName(info.Continent.GeoNameID, info.Continent.Names, chain)
+	ipInfo.noteUntranslated("continent", info.Continent.GeoNameID, chain, ipInfo.Languages.Continent)
+	ipInfo.Country, ipInfo.Languages.Country = localizedName(info.Country.GeoNameID, info.Country.Names, chain)
+	ipInfo.noteUntranslated("country", info.Country.GeoNameID, chain, ipInfo.Languages.Country)
+	// province
+	if len(info.Subdivisions) > 0 {
+		region := info.Subdivisions[0]
+		ipInfo.Region, ipInfo.Languages.Region = localizedName(region.GeoNameID, region.Names, chain)
+		ipInfo.noteUntranslated("region", region.GeoNameID, chain, ipInfo.Languages.Region)
+		ipInfo.RegionCode = region.IsoCode
 	}
-	// isp
-	ispNameCn := make([]string, 0)
-	for _, isp := range strings.Split(info.Traits.ISP, "/") {
-		if ispCn, ok := ispName[isp]; ok {
-			ispNameCn = append(ispNameCn, ispCn)
-		} else {
-			ispNameCn = append(ispNameCn, isp)
-		}
+	// city
+	if len(info.Subdivisions) > 1 {
+		city := info.Subdivisions[1]
+		ipInfo.City, ipInfo.Languages.City = localizedName(city.GeoNameID, city.Names, chain)
+		ipInfo.noteUntranslated("city", city.GeoNameID, chain, ipInfo.Languages.City)
 	}
-	if lang == "zh-CN" {
-		ipInfo.ISP = strings.Join(ispNameCn, "/")
-	} else {
-		ipInfo.ISP = info.Traits.ISP
+	ipInfo.UserType, ipInfo.Languages.UserType = chainUserType(info.Traits.UserType, chain)
+	if network, err := netip.ParsePrefix(info.Traits.Network); err == nil {
+		ipInfo.Network = newNetworkRange(network)
 	}
-	// continent
-	if continent, ok := info.Continent.Names[lang]; ok {
-		ipInfo.Continent = continent
-	} else if continent, ok := info.Continent.Names[secondLang]; ok {
-		ipInfo.Continent = continent
-	} else {
-		for _, v := range info.Continent.Names {
-			ipInfo.Continent = v
-			break
+	ipInfo.ASN = info.Traits.AutonomousSystemNumber
+	ipInfo.ASOrganization = info.Traits.AutonomousSystemOrganization
+	if info.Traits.IsAnonymous {
+		ipInfo.Anonymous = &Anonymous{
+			IsAnonymous:        info.Traits.IsAnonymous,
+			IsAnonymousVPN:     info.Traits.IsAnonymousVPN,
+			IsHostingProvider:  info.Traits.IsHostingProvider,
+			IsPublicProxy:      info.Traits.IsPublicProxy,
+			IsResidentialProxy: info.Traits.IsResidentialProxy,
+			IsTorExitNode:      info.Traits.IsTorExitNode,
 		}
 	}
-	// country
-	if country, ok := info.Country.Names[lang]; ok {
-		ipInfo.Country = country
-	} else if country, ok := info.Country.Names[secondLang]; ok {
-		ipInfo.Country = country
-	} else {
-		for _, v := range info.Country.Names {
-			ipInfo.Country = v
-			break
-		}
+
+	return ipInfo
+}
+
+// GetIPInfoFromCompact is the CompactLocationISP counterpart of
+// GetIPInfoFromLocationISP.
+func GetIPInfoFromCompact(info *geoip2.CompactLocationISP, lang string) *IPInfo {
+	ipInfo := &IPInfo{
+		ContinentCode: info.Continent.Code,
+		CountryCode:   info.Country.IsoCode,
+		Postal:        info.Postal.Code,
+		TimeZone:      info.Location.TimeZone,
+		Latitude:      info.Location.Latitude,
+		Longitude:     info.Location.Longitude,
 	}
+	chain := languageChain(lang)
+	ipInfo.ISP, ipInfo.Languages.ISP = chainISP(info.Traits.ISP, chain)
+	ipInfo.Continent, ipInfo.Languages.Continent = compactName(info.Continent.GeoNameID, info.Continent.Names, chain)
+	ipInfo.noteUntranslated("continent", info.Continent.GeoNameID, chain, ipInfo.Languages.Continent)
+	ipInfo.Country, ipInfo.Languages.Country = compactName(info.Country.GeoNameID, info.Country.Names, chain)
+	ipInfo.noteUntranslated("country", info.Country.GeoNameID, chain, ipInfo.Languages.Country)
 	// province
 	if len(info.Subdivisions) > 0 {
-		if v, ok := info.Subdivisions[0].Names[lang]; ok {
-			ipInfo.Region = v
-		} else if v, ok := info.Subdivisions[0].Names[secondLang]; ok {
-			ipInfo.Region = v
-		} else {
-			for _, v := range info.Subdivisions[0].Names {
-				ipInfo.Region = v
-				break
-			}
-		}
-		ipInfo.RegionCode = info.Subdivisions[0].IsoCode
+		region := info.Subdivisions[0]
+		ipInfo.Region, ipInfo.Languages.Region = compactName(region.GeoNameID, region.Names, chain)
+		ipInfo.noteUntranslated("region", region.GeoNameID, chain, ipInfo.Languages.Region)
+		ipInfo.RegionCode = region.IsoCode
 	}
 	// city
 	if len(info.Subdivisions) > 1 {
-		if v, ok := info.Subdivisions[1].Names[lang]; ok {
-			ipInfo.City = v
-		} else if v, ok := info.Subdivisions[1].Names[secondLang]; ok {
-			ipInfo.City = v
-		} else {
-			for _, v := range info.Subdivisions[1].Names {
-				ipInfo.City = v
-				break
-			}
-		}
+		city := info.Subdivisions[1]
+		ipInfo.City, ipInfo.Languages.City = compactName(city.GeoNameID, city.Names, chain)
+		ipInfo.noteUntranslated("city", city.GeoNameID, chain, ipInfo.Languages.City)
 	}
-	// user type
-	var userType string
-	if lang == "zh-CN" {
-		usertype, ok := map[string]string{
-			"hosting":     "数据中心",
-			"corporate":   "商业公司",
-			"business":    "商业公司",
-			"consumer":    "家庭住宅",
-			"cellular":    "蜂窝网络",
-			"residential": "家庭住宅",
-		}[info.Traits.UserType]
-		if !ok {
-			userType = info.Traits.UserType
-		} else {
-			userType = usertype
+	ipInfo.UserType, ipInfo.Languages.UserType = chainUserType(info.Traits.UserType, chain)
+	ipInfo.ASN = info.Traits.AutonomousSystemNumber
+	ipInfo.ASOrganization = info.Traits.AutonomousSystemOrganization
+	if info.Traits.IsAnonymous {
+		ipInfo.Anonymous = &Anonymous{
+			IsAnonymous:        info.Traits.IsAnonymous,
+			IsAnonymousVPN:     info.Traits.IsAnonymousVPN,
+			IsHostingProvider:  info.Traits.IsHostingProvider,
+			IsPublicProxy:      info.Traits.IsPublicProxy,
+			IsResidentialProxy: info.Traits.IsResidentialProxy,
+			IsTorExitNode:      info.Traits.IsTorExitNode,
 		}
-	} else {
-		userType = info.Traits.UserType
 	}
-	ipInfo.UserType = userType
 
 	return ipInfo
 }
+
+// compactUnnamed reports whether a place of info has no name in ipInfo,
+// which GetIPInfoFromLocationISP may find in a language compact records do
+// not carry.
+func compactUnnamed(info *geoip2.CompactLocationISP, ipInfo *IPInfo) bool {
+	return (info.Continent.Code != "" || info.Continent.GeoNameID != 0) && ipInfo.Continent == "" ||
+		(info.Country.IsoCode != "" || info.Country.GeoNameID != 0) && ipInfo.Country == "" ||
+		len(info.Subdivisions) > 0 && ipInfo.Region == "" ||
+		len(info.Subdivisions) > 1 && ipInfo.City == ""
+}
+
+func localizedISP(isp, lang string) string {
+	name, _ := translateISP(isp, lang)
+	return name
+}
+
+// translateISP returns isp in lang, translating the whole of it or else
+// its /-separated ISPs one by one, and whether any of it was translated.
+func translateISP(isp, lang string) (string, bool) {
+	d := ispNames.Load()
+	if name, ok := d.translate(isp, lang); ok {
+		return name, true
+	}
+	parts := strings.Split(isp, "/")
+	translated := false
+	for i, part := range parts {
+		if name, ok := d.translate(part, lang); ok {
+			parts[i] = name
+			translated = true
+		}
+	}
+	return strings.Join(parts, "/"), translated
+}
+
+// chainISP returns isp in the first language of chain its ISPs have names
+// in, and that language. The names of the databases are English ones.
+func chainISP(isp string, chain []string) (string, string) {
+	if isp == "" {
+		return "", ""
+	}
+	for _, lang := range chain {
+		if name, ok := translateISP(isp, lang); ok {
+			return toTraditional(name, lang, chain)
+		}
+		if lang == "en" {
+			break
+		}
+	}
+	return isp, "en"
+}
+
+var userTypeCn = map[string]string{
+	"hosting":     "数据中心",
+	"corporate":   "商业公司",
+	"business":    "商业公司",
+	"consumer":    "家庭住宅",
+	"cellular":    "蜂窝网络",
+	"residential": "家庭住宅",
+}
+
+func localizedUserType(userType, lang string) string {
+	if lang != "zh-CN" {
+		return userType
+	}
+	if v, ok := userTypeCn[userType]; ok {
+		return v
+	}
+	return userType
+}
+
+// chainUserType is the user type counterpart of chainISP.
+func chainUserType(userType string, chain []string) (string, string) {
+	if userType == "" {
+		return "", ""
+	}
+	for _, lang := range chain {
+		if lang == "zh-CN" {
+			if zh := localizedUserType(userType, lang); zh != userType {
+				return toTraditional(zh, lang, chain)
+			}
+		} else if lang == "en" {
+			break
+		}
+	}
+	return userType, "en"
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang"
+	"github.com/yuryqwer/ip2loc/internal/mmdbtest"
+)
+
+const testLocationType = "DBIP-Location-ISP (compat=Enterprise)"
+
+// writeDB writes db in the temporary directory of the test and returns its
+// path.
+func writeDB(t *testing.T, db *mmdbtest.Database) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := db.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// openDB opens the database db is written as.
+func openDB(t *testing.T, db *mmdbtest.Database) *geoip2.Reader {
+	t.Helper()
+	reader, err := NewDB(writeDB(t, db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return reader
+}
+
+// testPlace is a place of a location record.
+func testPlace(geoNameID int, names map[string]string) map[string]any {
+	return map[string]any{"geoname_id": geoNameID, "names": names}
+}
+
+// testLocation is a location record of the country code, named in English
+// and Chinese, with traits.
+func testLocation(code, en, zh string, traits map[string]any) map[string]any {
+	country := testPlace(1, map[string]string{"en": en, "zh-CN": zh})
+	country["iso_code"] = code
+	continent := testPlace(6255147, map[string]string{"en": "Asia", "zh-CN": "亚洲"})
+	continent["code"] = "AS"
+	record := map[string]any{
+		"continent": continent,
+		"country":   country,
+		"location":  map[string]any{"latitude": 22.5, "longitude": 114.1, "time_zone": "Asia/Shanghai"},
+		"subdivisions": []any{
+			testPlace(2, map[string]string{"en": "Guangdong", "zh-CN": "广东"}),
+			testPlace(3, map[string]string{"en": "Shenzhen", "zh-CN": "深圳"}),
+		},
+	}
+	if traits != nil {
+		record["traits"] = traits
+	}
+	return record
+}
+
+func TestLookupIPInfoCompact(t *testing.T) {
+	db := mmdbtest.New(testLocationType, "en", "zh-CN", "ja")
+	db.Insert("1.0.0.0/24", testLocation("CN", "China", "中国", map[string]any{
+		"isp":                      "China Telecom",
+		"user_type":                "residential",
+		"autonomous_system_number": 4134,
+	}))
+	db.Insert("1.0.1.0/24", testLocation("US", "United States", "美国", map[string]any{
+		"isp":                  "Mullvad",
+		"user_type":            "hosting",
+		"is_anonymous":         true,
+		"is_anonymous_vpn":     true,
+		"is_hosting_provider":  true,
+		"is_residential_proxy": false,
+	}))
+	unnamed := testLocation("JP", "Japan", "日本", nil)
+	unnamed["subdivisions"] = []any{
+		testPlace(4, map[string]string{"en": "Tokyo", "zh-CN": "东京"}),
+		testPlace(5, map[string]string{"ja": "港区"}),
+	}
+	db.Insert("1.0.2.0/24", unnamed)
+	db.Insert("1.0.3.0/24", map[string]any{"subdivisions": []any{map[string]any{"iso_code": "XX"}}})
+	db.Insert("2400:da00::/32", testLocation("CN", "China", "中国", nil))
+	reader := openDB(t, db)
+
+	for _, addr := range []string{"1.0.0.1", "1.0.1.1", "1.0.2.1", "1.0.3.1", "1.0.4.1", "2400:da00::1"} {
+		for _, lang := range []string{"zh-CN", "en", "zh-TW"} {
+			t.Run(addr+"/"+lang, func(t *testing.T) {
+				compact, err := LookupIPInfo(netip.MustParseAddr(addr), reader, lang)
+				if err != nil {
+					t.Fatal(err)
+				}
+				full, err := lookupFullIPInfo(netip.MustParseAddr(addr), reader, lang)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(compact, full) {
+					t.Errorf("compact %+v\nfull    %+v", compact, full)
+				}
+			})
+		}
+	}
+
+	info, err := LookupIPInfo(netip.MustParseAddr("1.0.1.1"), reader, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Anonymous == nil || !info.Anonymous.IsAnonymousVPN || !info.Anonymous.IsHostingProvider {
+		t.Errorf("anonymous = %+v", info.Anonymous)
+	}
+	info, err = LookupIPInfo(netip.MustParseAddr("1.0.2.1"), reader, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.City != "港区" || info.Languages.City != "ja" {
+		t.Errorf("city = %q in %q, want 港区 in ja", info.City, info.Languages.City)
+	}
+}
@@ -0,0 +1,143 @@
+package geoip2
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+)
+
+// LocalizedNames holds the names of a place in the languages ip2loc serves.
+// Decoding a names map into a struct skips every other language and saves
+// the map allocation the map[string]string fields in LocationISP need.
+type LocalizedNames struct {
+	En   string `maxminddb:"en"`
+	ZhCN string `maxminddb:"zh-CN"`
+}
+
+// The CompactLocationISP struct holds the subset of the dbip's
+// `IP to Location + ISP` record that is needed to answer a lookup. It is
+// meant to be reused across lookups through CompactLocationISP.
+type CompactLocationISP struct {
+	Continent struct {
+		Names     LocalizedNames `maxminddb:"names"`
+		Code      string         `maxminddb:"code"`
+		GeoNameID uint           `maxminddb:"geoname_id"`
+	} `maxminddb:"continent"`
+	Country struct {
+		Names     LocalizedNames `maxminddb:"names"`
+		IsoCode   string         `maxminddb:"iso_code"`
+		GeoNameID uint           `maxminddb:"geoname_id"`
+	} `maxminddb:"country"`
+	Location struct {
+		TimeZone  string  `maxminddb:"time_zone"`
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Subdivisions []struct {
+		Names     LocalizedNames `maxminddb:"names"`
+		IsoCode   string         `maxminddb:"iso_code"`
+		GeoNameID uint           `maxminddb:"geoname_id"`
+	} `maxminddb:"subdivisions"`
+	Traits struct {
+		AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+		ISP                          string `maxminddb:"isp"`
+		UserType                     string `maxminddb:"user_type"`
+		AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+		IsAnonymous                  bool   `maxminddb:"is_anonymous"`
+		IsAnonymousVPN               bool   `maxminddb:"is_anonymous_vpn"`
+		IsHostingProvider            bool   `maxminddb:"is_hosting_provider"`
+		IsPublicProxy                bool   `maxminddb:"is_public_proxy"`
+		IsResidentialProxy           bool   `maxminddb:"is_residential_proxy"`
+		IsTorExitNode                bool   `maxminddb:"is_tor_exit_node"`
+	} `maxminddb:"traits"`
+}
+
+// LocationISPAddr takes an IP address as a netip.Addr and returns a
+// LocationISP struct, the network the record was found under and/or an
+// error. Traits.Network is left empty; use the returned prefix instead.
+// The address is converted to a net.IP for maxminddb, see lookupAddr.
+func (r *Reader) LocationISPAddr(addr netip.Addr) (*LocationISP, netip.Prefix, error) {
+	if isEnterprise&r.databaseType == 0 {
+		return nil, netip.Prefix{}, InvalidMethodError{"LocationISP", r.Metadata().DatabaseType}
+	}
+	var locationISP LocationISP
+	network, err := r.lookupAddr(addr, &locationISP)
+	if err != nil {
+		return nil, network, err
+	}
+	return &locationISP, network, nil
+}
+
+// CompactLocationISP looks up addr and decodes the record into result,
+// which is reset first so that it can be reused across lookups. It returns
+// the network the record was found under. Nothing is decoded when the
+// database has no record for addr.
+func (r *Reader) CompactLocationISP(addr netip.Addr, result *CompactLocationISP) (netip.Prefix, error) {
+	if isEnterprise&r.databaseType == 0 {
+		return netip.Prefix{}, InvalidMethodError{"CompactLocationISP", r.Metadata().DatabaseType}
+	}
+	*result = CompactLocationISP{}
+	return r.lookupAddr(addr, result)
+}
+
+// ASNAddr takes an IP address as a netip.Addr and returns a ASN struct
+// and/or an error.
+func (r *Reader) ASNAddr(addr netip.Addr) (*ASN, error) {
+	if isASN&r.databaseType == 0 {
+		return nil, InvalidMethodError{"ASN", r.Metadata().DatabaseType}
+	}
+	var val ASN
+	_, err := r.lookupAddr(addr, &val)
+	return &val, err
+}
+
+// AnonymousIPAddr takes an IP address as a netip.Addr and returns a
+// AnonymousIP struct and/or an error.
+func (r *Reader) AnonymousIPAddr(addr netip.Addr) (*AnonymousIP, error) {
+	if isAnonymousIP&r.databaseType == 0 {
+		return nil, InvalidMethodError{"AnonymousIP", r.Metadata().DatabaseType}
+	}
+	var anonIP AnonymousIP
+	_, err := r.lookupAddr(addr, &anonIP)
+	return &anonIP, err
+}
+
+// NetworkAddr returns the network addr is found under without decoding its
+// record, which makes it a cheap key to cache what was decoded for addr.
+func (r *Reader) NetworkAddr(addr netip.Addr) (netip.Prefix, error) {
+	var skip struct{}
+	return r.lookupAddr(addr, &skip)
+}
+
+// lookupAddr is the netip.Addr counterpart of maxminddb's LookupNetwork.
+// netip is not supported natively: maxminddb-golang v1 only takes a net.IP
+// and returns a *net.IPNet, netip.Addr lookups coming with v2 and its new
+// decoding API. The address is handed over as a slice of a stack array so
+// that no net.IP has to be allocated for it, and the network is converted
+// back to a netip.Prefix.
+func (r *Reader) lookupAddr(addr netip.Addr, result any) (netip.Prefix, error) {
+	if !addr.IsValid() {
+		return netip.Prefix{}, errors.New("geoip2: the address passed to lookup is not valid")
+	}
+	var ip net.IP
+	a16 := addr.As16()
+	if addr.Is4() {
+		ip = net.IP(a16[12:])
+	} else {
+		ip = net.IP(a16[:])
+	}
+	network, _, err := r.mmdbReader.LookupNetwork(ip, result)
+	if network == nil {
+		return netip.Prefix{}, err
+	}
+	return prefixFromIPNet(network), err
+}
+
+func prefixFromIPNet(network *net.IPNet) netip.Prefix {
+	addr, _ := netip.AddrFromSlice(network.IP)
+	bits, _ := network.Mask.Size()
+	return netip.PrefixFrom(addr, bits).Masked()
+}
@@ -0,0 +1,85 @@
+package geoip2
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// LocationISPNetworks iterates over the networks of a dbip's
+// `IP to Location + ISP` database. It can be created using the
+// LocationISPNetworks and LocationISPNetworksWithin methods on Reader.
+//
+// IPv4 networks are only returned once, as IPv4 prefixes, even though an
+// IPv6 database maps them into several places of its tree.
+type LocationISPNetworks struct {
+	networks *maxminddb.Networks
+	err      error
+}
+
+// LocationISPNetworks returns an iterator over every network in the
+// database that has a record.
+func (r *Reader) LocationISPNetworks() *LocationISPNetworks {
+	if isEnterprise&r.databaseType == 0 {
+		return &LocationISPNetworks{
+			err: InvalidMethodError{"LocationISPNetworks", r.Metadata().DatabaseType},
+		}
+	}
+	return &LocationISPNetworks{
+		networks: r.mmdbReader.Networks(maxminddb.SkipAliasedNetworks),
+	}
+}
+
+// LocationISPNetworksWithin returns an iterator over every network with a
+// record that is contained in prefix. If prefix is itself contained in a
+// network of the database, that network is the only one returned.
+func (r *Reader) LocationISPNetworksWithin(prefix netip.Prefix) *LocationISPNetworks {
+	if isEnterprise&r.databaseType == 0 {
+		return &LocationISPNetworks{
+			err: InvalidMethodError{"LocationISPNetworksWithin", r.Metadata().DatabaseType},
+		}
+	}
+	prefix = prefix.Masked()
+	network := &net.IPNet{
+		IP:   net.IP(prefix.Addr().AsSlice()),
+		Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+	}
+	return &LocationISPNetworks{
+		networks: r.mmdbReader.NetworksWithin(network, maxminddb.SkipAliasedNetworks),
+	}
+}
+
+// Next prepares the next network for reading with the Network method. It
+// returns false when there are no more networks or an error occurred.
+func (n *LocationISPNetworks) Next() bool {
+	if n.err != nil {
+		return false
+	}
+	return n.networks.Next()
+}
+
+// Network returns the current network and its decoded record, or an
+// error if the record cannot be decoded. Traits.Network is set to the
+// string form of the network, as LocationISP does.
+func (n *LocationISPNetworks) Network() (netip.Prefix, *LocationISP, error) {
+	if n.err != nil {
+		return netip.Prefix{}, nil, n.err
+	}
+	var locationISP LocationISP
+	network, err := n.networks.Network(&locationISP)
+	if err != nil {
+		return netip.Prefix{}, nil, err
+	}
+	prefix := prefixFromIPNet(network)
+	locationISP.Traits.Network = prefix.String()
+	return prefix, &locationISP, nil
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (n *LocationISPNetworks) Err() error {
+	if n.err != nil {
+		return n.err
+	}
+	return n.networks.Err()
+}
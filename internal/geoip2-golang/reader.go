@@ -54,9 +54,185 @@ type LocationISP struct {
 		ISP                          string `maxminddb:"isp" json:"isp"`
 		Organization                 string `maxminddb:"organization" json:"organization"`
 		Network                      string `json:"network"`
+		IsAnonymous                  bool   `maxminddb:"is_anonymous" json:"is_anonymous,omitempty"`
+		IsAnonymousVPN               bool   `maxminddb:"is_anonymous_vpn" json:"is_anonymous_vpn,omitempty"`
+		IsHostingProvider            bool   `maxminddb:"is_hosting_provider" json:"is_hosting_provider,omitempty"`
+		IsPublicProxy                bool   `maxminddb:"is_public_proxy" json:"is_public_proxy,omitempty"`
+		IsResidentialProxy           bool   `maxminddb:"is_residential_proxy" json:"is_residential_proxy,omitempty"`
+		IsTorExitNode                bool   `maxminddb:"is_tor_exit_node" json:"is_tor_exit_node,omitempty"`
 	} `maxminddb:"traits" json:"traits"`
 }
 
+// The Enterprise struct corresponds to the data in the GeoIP2 Enterprise
+// database.
+type Enterprise struct {
+	Continent struct {
+		Names     map[string]string `maxminddb:"names"`
+		Code      string            `maxminddb:"code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	} `maxminddb:"continent"`
+	City struct {
+		Names      map[string]string `maxminddb:"names"`
+		GeoNameID  uint              `maxminddb:"geoname_id"`
+		Confidence uint8             `maxminddb:"confidence"`
+	} `maxminddb:"city"`
+	Postal struct {
+		Code       string `maxminddb:"code"`
+		Confidence uint8  `maxminddb:"confidence"`
+	} `maxminddb:"postal"`
+	Subdivisions []struct {
+		Names      map[string]string `maxminddb:"names"`
+		IsoCode    string            `maxminddb:"iso_code"`
+		GeoNameID  uint              `maxminddb:"geoname_id"`
+		Confidence uint8             `maxminddb:"confidence"`
+	} `maxminddb:"subdivisions"`
+	RepresentedCountry struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		Type              string            `maxminddb:"type"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"represented_country"`
+	Country struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		Confidence        uint8             `maxminddb:"confidence"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		Confidence        uint8             `maxminddb:"confidence"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"registered_country"`
+	Traits struct {
+		AutonomousSystemOrganization string  `maxminddb:"autonomous_system_organization"`
+		ConnectionType               string  `maxminddb:"connection_type"`
+		Domain                       string  `maxminddb:"domain"`
+		ISP                          string  `maxminddb:"isp"`
+		MobileCountryCode            string  `maxminddb:"mobile_country_code"`
+		MobileNetworkCode            string  `maxminddb:"mobile_network_code"`
+		Organization                 string  `maxminddb:"organization"`
+		UserType                     string  `maxminddb:"user_type"`
+		AutonomousSystemNumber       uint    `maxminddb:"autonomous_system_number"`
+		StaticIPScore                float64 `maxminddb:"static_ip_score"`
+		IsAnonymousProxy             bool    `maxminddb:"is_anonymous_proxy"`
+		IsLegitimateProxy            bool    `maxminddb:"is_legitimate_proxy"`
+		IsSatelliteProvider          bool    `maxminddb:"is_satellite_provider"`
+	} `maxminddb:"traits"`
+	Location struct {
+		TimeZone       string  `maxminddb:"time_zone"`
+		Latitude       float64 `maxminddb:"latitude"`
+		Longitude      float64 `maxminddb:"longitude"`
+		MetroCode      uint    `maxminddb:"metro_code"`
+		AccuracyRadius uint16  `maxminddb:"accuracy_radius"`
+	} `maxminddb:"location"`
+}
+
+// The City struct corresponds to the data in the GeoIP2/GeoLite2 City
+// databases.
+type City struct {
+	City struct {
+		Names     map[string]string `maxminddb:"names"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	} `maxminddb:"city"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Continent struct {
+		Names     map[string]string `maxminddb:"names"`
+		Code      string            `maxminddb:"code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	} `maxminddb:"continent"`
+	Subdivisions []struct {
+		Names     map[string]string `maxminddb:"names"`
+		IsoCode   string            `maxminddb:"iso_code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	} `maxminddb:"subdivisions"`
+	RepresentedCountry struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		Type              string            `maxminddb:"type"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"represented_country"`
+	Country struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"registered_country"`
+	Location struct {
+		TimeZone       string  `maxminddb:"time_zone"`
+		Latitude       float64 `maxminddb:"latitude"`
+		Longitude      float64 `maxminddb:"longitude"`
+		MetroCode      uint    `maxminddb:"metro_code"`
+		AccuracyRadius uint16  `maxminddb:"accuracy_radius"`
+	} `maxminddb:"location"`
+	Traits struct {
+		IsAnonymousProxy    bool `maxminddb:"is_anonymous_proxy"`
+		IsSatelliteProvider bool `maxminddb:"is_satellite_provider"`
+	} `maxminddb:"traits"`
+}
+
+// The Country struct corresponds to the data in the GeoIP2/GeoLite2
+// Country databases.
+type Country struct {
+	Continent struct {
+		Names     map[string]string `maxminddb:"names"`
+		Code      string            `maxminddb:"code"`
+		GeoNameID uint              `maxminddb:"geoname_id"`
+	} `maxminddb:"continent"`
+	Country struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"registered_country"`
+	RepresentedCountry struct {
+		Names             map[string]string `maxminddb:"names"`
+		IsoCode           string            `maxminddb:"iso_code"`
+		Type              string            `maxminddb:"type"`
+		GeoNameID         uint              `maxminddb:"geoname_id"`
+		IsInEuropeanUnion bool              `maxminddb:"is_in_european_union"`
+	} `maxminddb:"represented_country"`
+	Traits struct {
+		IsAnonymousProxy    bool `maxminddb:"is_anonymous_proxy"`
+		IsSatelliteProvider bool `maxminddb:"is_satellite_provider"`
+	} `maxminddb:"traits"`
+}
+
+// The AnonymousIP struct corresponds to the data in the GeoIP2
+// Anonymous IP database.
+type AnonymousIP struct {
+	IsAnonymous        bool `maxminddb:"is_anonymous"`
+	IsAnonymousVPN     bool `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider  bool `maxminddb:"is_hosting_provider"`
+	IsPublicProxy      bool `maxminddb:"is_public_proxy"`
+	IsResidentialProxy bool `maxminddb:"is_residential_proxy"`
+	IsTorExitNode      bool `maxminddb:"is_tor_exit_node"`
+}
+
+// The ASN struct corresponds to the data in the GeoLite2 ASN database.
+type ASN struct {
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+}
+
 // The ConnectionType struct corresponds to the data in the GeoIP2
 // Connection-Type database.
 type ConnectionType struct {
@@ -68,6 +244,16 @@ type Domain struct {
 	Domain string `maxminddb:"domain"`
 }
 
+// The ISP struct corresponds to the data in the GeoIP2 ISP database.
+type ISP struct {
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+	ISP                          string `maxminddb:"isp"`
+	MobileCountryCode            string `maxminddb:"mobile_country_code"`
+	MobileNetworkCode            string `maxminddb:"mobile_network_code"`
+	Organization                 string `maxminddb:"organization"`
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+}
+
 type databaseType int
 
 const (
@@ -138,42 +324,15 @@ func FromBytes(bytes []byte) (*Reader, error) {
 }
 
 func getDBType(reader *maxminddb.Reader) (databaseType, error) {
-	switch reader.Metadata.DatabaseType {
-	case "GeoIP2-Anonymous-IP":
-		return isAnonymousIP, nil
-	case "DBIP-ASN-Lite (compat=GeoLite2-ASN)",
-		"GeoLite2-ASN":
-		return isASN, nil
-	// We allow City lookups on Country for back compat
-	case "DBIP-City-Lite",
-		"DBIP-Country-Lite",
-		"DBIP-Country",
-		"DBIP-Location (compat=City)",
-		"GeoLite2-City",
-		"GeoIP2-City",
-		"GeoIP2-City-Africa",
-		"GeoIP2-City-Asia-Pacific",
-		"GeoIP2-City-Europe",
-		"GeoIP2-City-North-America",
-		"GeoIP2-City-South-America",
-		"GeoIP2-Precision-City",
-		"GeoLite2-Country",
-		"GeoIP2-Country":
-		return isCity | isCountry, nil
-	case "GeoIP2-Connection-Type":
-		return isConnectionType, nil
-	case "GeoIP2-Domain":
-		return isDomain, nil
-	case "DBIP-ISP (compat=Enterprise)",
-		"DBIP-Location-ISP (compat=Enterprise)",
-		"GeoIP2-Enterprise",
-		"IPCC-Location-ISP-Enterprise":
-		return isEnterprise | isCity | isCountry, nil
-	case "GeoIP2-ISP", "GeoIP2-Precision-ISP":
-		return isISP | isASN, nil
-	default:
-		return 0, UnknownDatabaseTypeError{reader.Metadata.DatabaseType}
+	if dbType, ok := lookupDatabaseType(reader.Metadata.DatabaseType); ok {
+		return dbType, nil
+	}
+	if detectUnknown.Load() {
+		if dbType := detectDBType(reader); dbType != 0 {
+			return dbType, nil
+		}
 	}
+	return 0, UnknownDatabaseTypeError{reader.Metadata.DatabaseType}
 }
 
 // LocationISP takes an IP address as a net.IP struct and returns an LocationISP
@@ -192,6 +351,65 @@ func (r *Reader) LocationISP(ipAddress net.IP) (*LocationISP, error) {
 	return &locationISP, err
 }
 
+// Enterprise takes an IP address as a net.IP struct and returns an Enterprise
+// struct and/or an error. This is intended to be used with the GeoIP2
+// Enterprise database.
+func (r *Reader) Enterprise(ipAddress net.IP) (*Enterprise, error) {
+	if isEnterprise&r.databaseType == 0 {
+		return nil, InvalidMethodError{"Enterprise", r.Metadata().DatabaseType}
+	}
+	var enterprise Enterprise
+	err := r.mmdbReader.Lookup(ipAddress, &enterprise)
+	return &enterprise, err
+}
+
+// City takes an IP address as a net.IP struct and returns a City struct
+// and/or an error. Although this can be used with other databases, this
+// method generally should be used with the GeoIP2 or GeoLite2 City databases.
+func (r *Reader) City(ipAddress net.IP) (*City, error) {
+	if isCity&r.databaseType == 0 {
+		return nil, InvalidMethodError{"City", r.Metadata().DatabaseType}
+	}
+	var city City
+	err := r.mmdbReader.Lookup(ipAddress, &city)
+	return &city, err
+}
+
+// Country takes an IP address as a net.IP struct and returns a Country struct
+// and/or an error. Although this can be used with other databases, this
+// method generally should be used with the GeoIP2 or GeoLite2 Country
+// databases.
+func (r *Reader) Country(ipAddress net.IP) (*Country, error) {
+	if isCountry&r.databaseType == 0 {
+		return nil, InvalidMethodError{"Country", r.Metadata().DatabaseType}
+	}
+	var country Country
+	err := r.mmdbReader.Lookup(ipAddress, &country)
+	return &country, err
+}
+
+// AnonymousIP takes an IP address as a net.IP struct and returns a
+// AnonymousIP struct and/or an error.
+func (r *Reader) AnonymousIP(ipAddress net.IP) (*AnonymousIP, error) {
+	if isAnonymousIP&r.databaseType == 0 {
+		return nil, InvalidMethodError{"AnonymousIP", r.Metadata().DatabaseType}
+	}
+	var anonIP AnonymousIP
+	err := r.mmdbReader.Lookup(ipAddress, &anonIP)
+	return &anonIP, err
+}
+
+// ASN takes an IP address as a net.IP struct and returns a ASN struct and/or
+// an error.
+func (r *Reader) ASN(ipAddress net.IP) (*ASN, error) {
+	if isASN&r.databaseType == 0 {
+		return nil, InvalidMethodError{"ASN", r.Metadata().DatabaseType}
+	}
+	var val ASN
+	err := r.mmdbReader.Lookup(ipAddress, &val)
+	return &val, err
+}
+
 // ConnectionType takes an IP address as a net.IP struct and returns a
 // ConnectionType struct and/or an error.
 func (r *Reader) ConnectionType(ipAddress net.IP) (*ConnectionType, error) {
@@ -214,12 +432,30 @@ func (r *Reader) Domain(ipAddress net.IP) (*Domain, error) {
 	return &val, err
 }
 
+// ISP takes an IP address as a net.IP struct and returns a ISP struct and/or
+// an error.
+func (r *Reader) ISP(ipAddress net.IP) (*ISP, error) {
+	if isISP&r.databaseType == 0 {
+		return nil, InvalidMethodError{"ISP", r.Metadata().DatabaseType}
+	}
+	var val ISP
+	err := r.mmdbReader.Lookup(ipAddress, &val)
+	return &val, err
+}
+
 // Metadata takes no arguments and returns a struct containing metadata about
 // the MaxMind database in use by the Reader.
 func (r *Reader) Metadata() maxminddb.Metadata {
 	return r.mmdbReader.Metadata
 }
 
+// Verify checks that the database is a valid MaxMind DB. It validates the
+// metadata, the search tree and the data section, which takes a walk of the
+// whole file.
+func (r *Reader) Verify() error {
+	return r.mmdbReader.Verify()
+}
+
 // Close unmaps the database file from virtual memory and returns the
 // resources to the system.
 func (r *Reader) Close() error {
@@ -3,6 +3,8 @@ package geoip2
 import (
 	"math/rand"
 	"net"
+	"net/netip"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -240,6 +242,168 @@ func TestISP(t *testing.T) {
 	assert.Equal(t, "Verizon Wireless", record.Organization)
 }
 
+func TestLocationISPAddr(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-Enterprise-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	addr := netip.MustParseAddr("149.101.100.0")
+	record, network, err := reader.LocationISPAddr(addr)
+	require.NoError(t, err)
+
+	assert.True(t, network.Contains(addr))
+	assert.Equal(t, uint(6167), record.Traits.AutonomousSystemNumber)
+	assert.Equal(t, "Verizon Wireless", record.Traits.ISP)
+	assert.Empty(t, record.Traits.Network)
+
+	legacy, err := reader.LocationISP(net.ParseIP("149.101.100.0"))
+	require.NoError(t, err)
+	assert.Equal(t, legacy.Traits.Network, network.String())
+
+	_, _, err = reader.LocationISPAddr(netip.Addr{})
+	assert.Error(t, err)
+
+	only, err := reader.NetworkAddr(addr)
+	require.NoError(t, err)
+	assert.Equal(t, network, only)
+}
+
+func TestCompactLocationISP(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-Enterprise-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	var record CompactLocationISP
+	addr := netip.MustParseAddr("149.101.100.0")
+	network, err := reader.CompactLocationISP(addr, &record)
+	require.NoError(t, err)
+
+	assert.True(t, network.Contains(addr))
+	assert.Equal(t, "Verizon Wireless", record.Traits.ISP)
+
+	full, err := reader.LocationISP(net.ParseIP("149.101.100.0"))
+	require.NoError(t, err)
+	assert.Equal(t, full.Country.IsoCode, record.Country.IsoCode)
+	assert.Equal(t, full.Country.Names["en"], record.Country.Names.En)
+	assert.Equal(t, full.Continent.Names["zh-CN"], record.Continent.Names.ZhCN)
+
+	// The record is reset before decoding, so nothing leaks from an
+	// earlier lookup when it is reused.
+	_, err = reader.CompactLocationISP(netip.MustParseAddr("::"), &record)
+	require.NoError(t, err)
+	assert.Equal(t, CompactLocationISP{}, record)
+
+	reader, err = Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, err = reader.CompactLocationISP(addr, &record)
+	assert.IsType(t, InvalidMethodError{}, err)
+}
+
+func TestLocationISPNetworks(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-Enterprise-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	seen := make(map[netip.Prefix]bool)
+	networks := reader.LocationISPNetworks()
+	for networks.Next() {
+		network, record, err := networks.Network()
+		require.NoError(t, err)
+
+		assert.False(t, seen[network], "%s returned twice", network)
+		seen[network] = true
+		assert.Equal(t, network.String(), record.Traits.Network)
+
+		lookup, _, err := reader.LocationISPAddr(network.Addr())
+		require.NoError(t, err)
+		assert.Equal(t, lookup.Traits.ISP, record.Traits.ISP)
+	}
+	require.NoError(t, networks.Err())
+	assert.NotEmpty(t, seen)
+
+	within := netip.MustParsePrefix("149.101.0.0/16")
+	count := 0
+	networks = reader.LocationISPNetworksWithin(within)
+	for networks.Next() {
+		network, _, err := networks.Network()
+		require.NoError(t, err)
+		assert.True(t, within.Overlaps(network))
+		assert.True(t, network.Addr().Is4())
+		count++
+	}
+	require.NoError(t, networks.Err())
+	assert.NotZero(t, count)
+
+	reader, err = Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	networks = reader.LocationISPNetworks()
+	assert.False(t, networks.Next())
+	assert.IsType(t, InvalidMethodError{}, networks.Err())
+}
+
+func TestRegisterDatabaseType(t *testing.T) {
+	defer func() {
+		registryMu.Lock()
+		delete(registeredTypes, "GeoIP2-Domain")
+		registryMu.Unlock()
+	}()
+
+	require.NoError(t, RegisterDatabaseType("GeoIP2-Domain", "Domain", "ASN"))
+
+	reader, err := Open("test-data/test-data/GeoIP2-Domain-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	_, err = reader.ASN(net.ParseIP("1.2.0.0"))
+	require.NoError(t, err)
+	_, err = reader.City(net.ParseIP("1.2.0.0"))
+	assert.IsType(t, InvalidMethodError{}, err)
+
+	assert.Error(t, RegisterDatabaseType("GeoIP2-Domain", "Domain", "Weather"))
+	assert.Error(t, RegisterDatabaseType("GeoIP2-Domain"))
+	assert.Error(t, RegisterDatabaseType("", "Domain"))
+}
+
+func TestDetectDBType(t *testing.T) {
+	tests := map[string]databaseType{
+		"GeoIP2-City-Test.mmdb":         isCity | isCountry,
+		"GeoIP2-Enterprise-Test.mmdb":   isEnterprise | isCity | isCountry,
+		"GeoLite2-ASN-Test.mmdb":        isASN,
+		"GeoIP2-Anonymous-IP-Test.mmdb": isAnonymousIP,
+		"GeoIP2-Domain-Test.mmdb":       isDomain,
+	}
+	for file, want := range tests {
+		reader, err := Open("test-data/test-data/" + file)
+		require.NoError(t, err)
+
+		got := detectDBType(reader.mmdbReader)
+		assert.Equal(t, want, got&want, file)
+		reader.Close()
+	}
+}
+
+func TestVerify(t *testing.T) {
+	reader, err := Open("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.NoError(t, err)
+	defer reader.Close()
+
+	assert.NoError(t, reader.Verify())
+
+	bytes, err := os.ReadFile("test-data/test-data/GeoIP2-City-Test.mmdb")
+	require.NoError(t, err)
+	// overwrite the start of the search tree, as a half-copied file would
+	for i := 0; i < 64; i++ {
+		bytes[i] = 0xff
+	}
+	corrupted, err := FromBytes(bytes)
+	require.NoError(t, err)
+	assert.Error(t, corrupted.Verify())
+}
+
 // This ensures the compiler does not optimize away the function call.
 var cityResult *City
 
@@ -292,6 +456,85 @@ func BenchmarkASN(b *testing.B) {
 	asnResult = asn
 }
 
+// This ensures the compiler does not optimize away the function call.
+var locationISPResult *LocationISP
+
+func BenchmarkLocationISP(b *testing.B) {
+	db, err := Open("test-data/test-data/GeoIP2-Enterprise-Test.mmdb")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	//nolint:gosec // this is just a benchmark
+	r := rand.New(rand.NewSource(0))
+
+	var locationISP *LocationISP
+
+	b.ReportAllocs()
+	ip := make(net.IP, 4)
+	for i := 0; i < b.N; i++ {
+		randomIPv4Address(r, ip)
+		locationISP, err = db.LocationISP(ip)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	locationISPResult = locationISP
+}
+
+func BenchmarkLocationISPAddr(b *testing.B) {
+	db, err := Open("test-data/test-data/GeoIP2-Enterprise-Test.mmdb")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	//nolint:gosec // this is just a benchmark
+	r := rand.New(rand.NewSource(0))
+
+	var locationISP *LocationISP
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		locationISP, _, err = db.LocationISPAddr(randomIPv4Addr(r))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	locationISPResult = locationISP
+}
+
+// This ensures the compiler does not optimize away the function call.
+var compactLocationISPResult CompactLocationISP
+
+func BenchmarkCompactLocationISP(b *testing.B) {
+	db, err := Open("test-data/test-data/GeoIP2-Enterprise-Test.mmdb")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	//nolint:gosec // this is just a benchmark
+	r := rand.New(rand.NewSource(0))
+
+	var compact CompactLocationISP
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err = db.CompactLocationISP(randomIPv4Addr(r), &compact)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	compactLocationISPResult = compact
+}
+
+func randomIPv4Addr(r *rand.Rand) netip.Addr {
+	num := r.Uint32()
+	return netip.AddrFrom4([4]byte{byte(num >> 24), byte(num >> 16), byte(num >> 8), byte(num)})
+}
+
 func randomIPv4Address(r *rand.Rand, ip net.IP) {
 	num := r.Uint32()
 	ip[0] = byte(num >> 24)
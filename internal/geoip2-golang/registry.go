@@ -0,0 +1,164 @@
+package geoip2
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// builtinDatabaseTypes maps the database_type metadata of the databases
+// this package knows to the lookup methods they support.
+var builtinDatabaseTypes = map[string]databaseType{
+	"GeoIP2-Anonymous-IP": isAnonymousIP,
+
+	"DBIP-ASN-Lite (compat=GeoLite2-ASN)": isASN,
+	"GeoLite2-ASN":                        isASN,
+
+	// We allow City lookups on Country for back compat
+	"DBIP-City-Lite":              isCity | isCountry,
+	"DBIP-Country-Lite":           isCity | isCountry,
+	"DBIP-Country":                isCity | isCountry,
+	"DBIP-Location (compat=City)": isCity | isCountry,
+	"GeoLite2-City":               isCity | isCountry,
+	"GeoIP2-City":                 isCity | isCountry,
+	"GeoIP2-City-Africa":          isCity | isCountry,
+	"GeoIP2-City-Asia-Pacific":    isCity | isCountry,
+	"GeoIP2-City-Europe":          isCity | isCountry,
+	"GeoIP2-City-North-America":   isCity | isCountry,
+	"GeoIP2-City-South-America":   isCity | isCountry,
+	"GeoIP2-Precision-City":       isCity | isCountry,
+	"GeoLite2-Country":            isCity | isCountry,
+	"GeoIP2-Country":              isCity | isCountry,
+
+	"GeoIP2-Connection-Type": isConnectionType,
+
+	"GeoIP2-Domain": isDomain,
+
+	"DBIP-ISP (compat=Enterprise)":          isEnterprise | isCity | isCountry,
+	"DBIP-Location-ISP (compat=Enterprise)": isEnterprise | isCity | isCountry,
+	"GeoIP2-Enterprise":                     isEnterprise | isCity | isCountry,
+	"IPCC-Location-ISP-Enterprise":          isEnterprise | isCity | isCountry,
+
+	"GeoIP2-ISP":           isISP | isASN,
+	"GeoIP2-Precision-ISP": isISP | isASN,
+}
+
+// methodCapabilities maps the name of a lookup method of Reader to the
+// capability it requires.
+var methodCapabilities = map[string]databaseType{
+	"AnonymousIP":    isAnonymousIP,
+	"ASN":            isASN,
+	"City":           isCity,
+	"ConnectionType": isConnectionType,
+	"Country":        isCountry,
+	"Domain":         isDomain,
+	"Enterprise":     isEnterprise,
+	"LocationISP":    isEnterprise,
+	"ISP":            isISP,
+}
+
+var (
+	registryMu      sync.RWMutex
+	registeredTypes = make(map[string]databaseType)
+	detectUnknown   atomic.Bool
+)
+
+// RegisterDatabaseType makes databases whose database_type metadata is
+// dbType support the given lookup methods, named as the methods of Reader:
+// AnonymousIP, ASN, City, ConnectionType, Country, Domain, Enterprise,
+// LocationISP and ISP. It takes precedence over the built-in types and only
+// affects databases opened afterwards.
+func RegisterDatabaseType(dbType string, methods ...string) error {
+	if dbType == "" {
+		return errors.New("geoip2: cannot register an empty database type")
+	}
+	if len(methods) == 0 {
+		return fmt.Errorf("geoip2: no lookup methods given for the %q database type", dbType)
+	}
+	var capabilities databaseType
+	for _, method := range methods {
+		capability, ok := methodCapabilities[method]
+		if !ok {
+			return fmt.Errorf("geoip2: unknown lookup method %q for the %q database type", method, dbType)
+		}
+		capabilities |= capability
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registeredTypes[dbType] = capabilities
+	return nil
+}
+
+// DetectUnknownDatabaseTypes sets whether Open and FromBytes, instead of
+// returning an UnknownDatabaseTypeError for a database type that is neither
+// built in nor registered, guess the lookup methods it supports from the
+// fields of a sample of its records.
+func DetectUnknownDatabaseTypes(enable bool) {
+	detectUnknown.Store(enable)
+}
+
+func lookupDatabaseType(dbType string) (databaseType, bool) {
+	registryMu.RLock()
+	capabilities, ok := registeredTypes[dbType]
+	registryMu.RUnlock()
+	if ok {
+		return capabilities, true
+	}
+	capabilities, ok = builtinDatabaseTypes[dbType]
+	return capabilities, ok
+}
+
+// detectSampleSize is how many records detectDBType looks at.
+const detectSampleSize = 64
+
+// detectDBType guesses the capabilities of a database from the fields of
+// its first records. It returns 0 when nothing is recognized.
+func detectDBType(reader *maxminddb.Reader) databaseType {
+	var capabilities databaseType
+	networks := reader.Networks(maxminddb.SkipAliasedNetworks)
+	for i := 0; i < detectSampleSize && networks.Next(); i++ {
+		var record map[string]any
+		if _, err := networks.Network(&record); err != nil {
+			break
+		}
+		capabilities |= detectRecord(record)
+	}
+	return capabilities
+}
+
+func detectRecord(record map[string]any) databaseType {
+	var capabilities databaseType
+	has := func(m map[string]any, key string) bool {
+		_, ok := m[key]
+		return ok
+	}
+	traits, _ := record["traits"].(map[string]any)
+
+	if has(record, "country") || has(record, "continent") {
+		capabilities |= isCity | isCountry
+		if traits != nil && (has(traits, "isp") || has(traits, "user_type") ||
+			has(traits, "autonomous_system_number")) {
+			capabilities |= isEnterprise
+		}
+	}
+	if has(record, "autonomous_system_number") {
+		capabilities |= isASN
+	}
+	if has(record, "isp") {
+		capabilities |= isISP
+	}
+	if has(record, "is_anonymous") {
+		capabilities |= isAnonymousIP
+	}
+	if has(record, "connection_type") {
+		capabilities |= isConnectionType
+	}
+	if has(record, "domain") {
+		capabilities |= isDomain
+	}
+	return capabilities
+}
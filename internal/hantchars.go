@@ -0,0 +1,113 @@
+package internal
+
+// hantChars pairs simplified characters with their traditional forms. When
+// a character has several traditional forms, the one used in the names of
+// places and companies is kept, and the others are left to the phrases in
+// hantCommonPhrases. Characters that stand for several traditional ones in
+// common names, such as 干, 台, 里, 于 and 谷, are left as they are.
+const hantChars = `
+碍礙 肮骯 袄襖 鳌鰲 奥奧 岙嶴
+坝壩 罢罷 摆擺 败敗 颁頒 办辦 绑綁 帮幫 谤謗 宝寶 报報 饱飽 鲍鮑 贝貝
+备備 惫憊 狈狽 辈輩 绷繃 笔筆 币幣 毕畢 毙斃 闭閉 边邊 编編 贬貶 变變
+辩辯 辫辮 标標 鳖鱉 别別 宾賓 滨濱 缤繽 槟檳 鬓鬢 饼餅 并並 拨撥 钵缽
+铂鉑 驳駁 补補
+财財 参參 残殘 惭慚 惨慘 灿燦 仓倉 苍蒼 舱艙 沧滄 厕廁 侧側 册冊 测測
+层層 诧詫 搀攙 掺摻 蝉蟬 馋饞 谗讒 缠纏 铲鏟 产產 阐闡 颤顫 场場 尝嘗
+长長 偿償 肠腸 厂廠 畅暢 钞鈔 车車 彻徹 尘塵 陈陳 衬襯 称稱 惩懲 诚誠
+骋騁 痴癡 迟遲 驰馳 耻恥 齿齒 炽熾 冲沖 虫蟲 宠寵 筹籌 畴疇 踌躊 丑醜
+础礎 处處 触觸 储儲 传傳 疮瘡 闯闖 创創 锤錘 纯純 绰綽 辞辭 词詞 赐賜
+聪聰 葱蔥 从從 丛叢 凑湊 蹿躥 窜竄 错錯
+达達 带帶 贷貸 单單 担擔 胆膽 惮憚 诞誕 弹彈 当當 挡擋 党黨 荡蕩 档檔
+导導 岛島 祷禱 盗盜 灯燈 邓鄧 敌敵 涤滌 递遞 缔締 颠顛 点點 垫墊 电電
+淀澱 钓釣 调調 谍諜 叠疊 钉釘 顶頂 锭錠 订訂 东東 动動 栋棟 冻凍 犊犢
+独獨 读讀 赌賭 镀鍍 锻鍛 断斷 缎緞 队隊 对對 吨噸 顿頓 夺奪 堕墮
+额額 讹訛 恶惡 饿餓 儿兒 尔爾 饵餌 贰貳
+发發 罚罰 阀閥 珐琺 矾礬 钒釩 烦煩 贩販 饭飯 访訪 纺紡 飞飛 诽誹 废廢
+费費 纷紛 坟墳 奋奮 愤憤 粪糞 丰豐 枫楓 锋鋒 风風 疯瘋 冯馮 缝縫 讽諷
+凤鳳 肤膚 辐輻 抚撫 辅輔 赋賦 复復 负負 讣訃 妇婦 缚縛
+该該 钙鈣 盖蓋 赶趕 秆稈 赣贛 冈岡 刚剛 钢鋼 纲綱 岗崗 镐鎬 搁擱 鸽鴿
+阁閣 铬鉻 个個 给給 龚龔 巩鞏 贡貢 钩鉤 沟溝 构構 购購 够夠 蛊蠱 顾顧
+关關 观觀 馆館 惯慣 贯貫 广廣 规規 归歸 龟龜 闺閨 轨軌 诡詭 贵貴 刽劊
+辊輥 滚滾 锅鍋 国國 过過
+骇駭 韩韓 汉漢 号號 阂閡 鹤鶴 贺賀 轰轟 鸿鴻 红紅 后後 壶壺 护護 沪滬
+户戶 哗嘩 华華 画畫 划劃 话話 怀懷 坏壞 欢歡 环環 还還 缓緩 换換 唤喚
+痪瘓 焕煥 涣渙 黄黃 谎謊 挥揮 辉輝 毁毀 贿賄 秽穢 会會 烩燴 汇匯 讳諱
+诲誨 绘繪 荤葷 浑渾 伙夥 获獲 货貨 祸禍
+击擊 机機 积積 饥飢 讥譏 鸡雞 绩績 缉緝 极極 辑輯 级級 挤擠 几幾 蓟薊
+剂劑 济濟 计計 记記 际際 继繼 纪紀 夹夾 荚莢 颊頰 贾賈 钾鉀 价價 驾駕
+歼殲 监監 坚堅 笺箋 间間 艰艱 缄緘 茧繭 检檢 碱鹼 拣揀 捡撿 简簡 俭儉
+减減 荐薦 槛檻 鉴鑒 践踐 贱賤 见見 键鍵 舰艦 剑劍 饯餞 渐漸 溅濺 涧澗
+将將 浆漿 蒋蔣 桨槳 奖獎 讲講 酱醬 胶膠 浇澆 骄驕 娇嬌 搅攪 铰鉸 矫矯
+侥僥 脚腳 饺餃 缴繳 绞絞 轿轎 较較 阶階 节節 洁潔 结結 诫誡 届屆 紧緊
+锦錦 仅僅 谨謹 进進 晋晉 烬燼 尽盡 劲勁 荆荊 茎莖 鲸鯨 惊驚 经經 颈頸
+镜鏡 径徑 痉痙 竞競 净淨 纠糾 厩廄 旧舊 驹駒 举舉 据據 锯鋸 惧懼 剧劇
+鹃鵑 绢絹 杰傑 诀訣 觉覺 绝絕 军軍 骏駿 钧鈞
+开開 凯凱 颗顆 壳殼 课課 垦墾 恳懇 抠摳 库庫 裤褲 夸誇 块塊 侩儈 宽寬
+矿礦 旷曠 况況 亏虧 岿巋 窥窺 馈饋 溃潰 扩擴 阔闊
+蜡蠟 腊臘 来來 赖賴 蓝藍 栏欄 拦攔 篮籃 阑闌 兰蘭 澜瀾 谰讕 揽攬 览覽
+懒懶 缆纜 烂爛 滥濫 捞撈 劳勞 涝澇 乐樂 镭鐳 垒壘 类類 泪淚 篱籬 离離
+鲤鯉 礼禮 丽麗 厉厲 励勵 砾礫 历歷 沥瀝 隶隸 俩倆 联聯 莲蓮 连連 镰鐮
+怜憐 涟漣 帘簾 敛斂 脸臉 链鏈 恋戀 炼煉 练練 粮糧 凉涼 两兩 辆輛 谅諒
+疗療 辽遼 镣鐐 猎獵 临臨 邻鄰 鳞鱗 凛凜 赁賃 龄齡 铃鈴 灵靈 岭嶺 领領
+馏餾 刘劉 浏瀏 龙龍 聋聾 咙嚨 笼籠 垄壟 拢攏 陇隴 楼樓 娄婁 搂摟 篓簍
+芦蘆 卢盧 颅顱 庐廬 炉爐 掳擄 卤鹵 虏虜 鲁魯 赂賂 录錄 陆陸 驴驢 吕呂
+铝鋁 侣侶 屡屢 缕縷 虑慮 滤濾 绿綠 峦巒 挛攣 孪孿 滦灤 栾欒 乱亂 抡掄
+轮輪 伦倫 仑崙 沦淪 纶綸 论論 萝蘿 罗羅 逻邏 锣鑼 箩籮 骡騾 骆駱 络絡
+妈媽 玛瑪 码碼 蚂螞 马馬 骂罵 吗嗎 买買 麦麥 卖賣 迈邁 脉脈 瞒瞞 馒饅
+蛮蠻 满滿 谩謾 猫貓 锚錨 铆鉚 贸貿 么麼 没沒 镁鎂 门門 闷悶 们們 锰錳
+梦夢 谜謎 弥彌 觅覓 绵綿 缅緬 庙廟 灭滅 悯憫 闽閩 鸣鳴 铭銘 谬謬 谋謀
+亩畝
+钠鈉 纳納 难難 挠撓 脑腦 恼惱 闹鬧 内內 馁餒 拟擬 腻膩 撵攆 酿釀 鸟鳥
+聂聶 啮齧 镊鑷 镍鎳 柠檸 狞獰 宁寧 拧擰 泞濘 钮鈕 纽紐 脓膿 浓濃 农農
+疟瘧 诺諾
+欧歐 鸥鷗 殴毆 呕嘔 沤漚
+盘盤 庞龐 赔賠 喷噴 鹏鵬 骗騙 飘飄 频頻 贫貧 苹蘋 凭憑 评評 泼潑 颇頗
+扑撲 铺鋪 谱譜
+栖棲 脐臍 齐齊 骑騎 岂豈 启啟 气氣 弃棄 讫訖 牵牽 铅鉛 迁遷 签簽 谦謙
+钱錢 钳鉗 潜潛 浅淺 谴譴 堑塹 枪槍 呛嗆 墙牆 蔷薔 强強 抢搶 锹鍬 桥橋
+乔喬 侨僑 翘翹 窍竅 窃竊 钦欽 亲親 寝寢 轻輕 氢氫 倾傾 顷頃 请請 庆慶
+琼瓊 穷窮 趋趨 区區 躯軀 驱驅 龋齲 颧顴 权權 劝勸 却卻 鹊鵲 确確
+让讓 饶饒 扰擾 绕繞 热熱 韧韌 认認 纫紉 荣榮 绒絨 软軟 锐銳 闰閏 润潤
+洒灑 萨薩 鳃鰓 赛賽 伞傘 丧喪 骚騷 扫掃 涩澀 杀殺 纱紗 筛篩 晒曬 闪閃
+陕陝 赡贍 缮繕 伤傷 赏賞 烧燒 绍紹 赊賒 摄攝 慑懾 设設 绅紳 审審 婶嬸
+肾腎 渗滲 声聲 绳繩 胜勝 圣聖 师師 狮獅 湿濕 诗詩 尸屍 时時 蚀蝕 实實
+识識 驶駛 势勢 适適 释釋 饰飾 视視 试試 寿壽 兽獸 枢樞 输輸 书書 赎贖
+属屬 术術 树樹 竖豎 数數 帅帥 双雙 谁誰 税稅 顺順 说說 硕碩 烁爍 丝絲
+饲飼 耸聳 怂慫 颂頌 讼訟 诵誦 擞擻 苏蘇 诉訴 肃肅 虽雖 随隨 绥綏 岁歲
+孙孫 损損 笋筍 缩縮 琐瑣 锁鎖
+獭獺 挞撻 摊攤 贪貪 瘫癱 滩灘 坛壇 谭譚 谈談 叹嘆 汤湯 烫燙 涛濤 绦絛
+讨討 腾騰 誊謄 锑銻 题題 体體 屉屜 条條 贴貼 铁鐵 厅廳 听聽 烃烴 铜銅
+统統 头頭 秃禿 图圖 团團 颓頹 脱脫 鸵鴕 驮馱 驼駝 椭橢
+袜襪 弯彎 湾灣 顽頑 万萬 网網 韦韋 违違 围圍 为為 潍濰 维維 苇葦 伟偉
+伪偽 纬緯 谓謂 卫衛 温溫 闻聞 纹紋 稳穩 问問 瓮甕 挝撾 蜗蝸 涡渦 窝窩
+卧臥 呜嗚 钨鎢 乌烏 诬誣 无無 芜蕪 吴吳 坞塢 雾霧 务務 误誤
+锡錫 牺犧 袭襲 习習 铣銑 戏戲 细細 虾蝦 辖轄 峡峽 侠俠 狭狹 厦廈 吓嚇
+鲜鮮 纤纖 贤賢 衔銜 闲閒 显顯 险險 现現 献獻 县縣 馅餡 羡羨 宪憲 线線
+厢廂 镶鑲 乡鄉 详詳 响響 项項 萧蕭 销銷 晓曉 啸嘯 蝎蠍 协協 挟挾 胁脅
+谐諧 写寫 泻瀉 谢謝 锌鋅 衅釁 兴興 汹洶 锈鏽 绣繡 须須 虚虛 许許 叙敘
+绪緒 续續 轩軒 悬懸 选選 癣癬 绚絢 学學 勋勳 询詢 寻尋 驯馴 训訓 讯訊
+逊遜
+压壓 鸦鴉 鸭鴨 哑啞 亚亞 讶訝 阉閹 烟煙 盐鹽 严嚴 颜顏 阎閻 艳豔 厌厭
+砚硯 彦彥 谚諺 验驗 鸯鴦 杨楊 扬揚 疡瘍 阳陽 痒癢 养養 样樣 瑶瑤 摇搖
+尧堯 遥遙 窑窯 谣謠 药藥 爷爺 页頁 业業 叶葉 医醫 铱銥 颐頤 遗遺 仪儀
+蚁蟻 艺藝 亿億 忆憶 义義 议議 谊誼 译譯 异異 绎繹 荫蔭 阴陰 银銀 饮飲
+隐隱 樱櫻 婴嬰 鹰鷹 应應 缨纓 莹瑩 萤螢 营營 荧熒 蝇蠅 赢贏 颖穎 哟喲
+拥擁 佣傭 痈癰 踊踴 咏詠 涌湧 优優 忧憂 邮郵 铀鈾 犹猶 诱誘 舆輿 鱼魚
+渔漁 娱娛 与與 屿嶼 语語 狱獄 誉譽 预預 驭馭 鸳鴛 渊淵 辕轅 园園 员員
+圆圓 缘緣 远遠 愿願 约約 跃躍 钥鑰 粤粵 悦悅 阅閱 云雲 郧鄖 匀勻 陨隕
+运運 蕴蘊 酝醞 晕暈 韵韻 余餘
+杂雜 灾災 载載 攒攢 暂暫 赞贊 赃贓 脏髒 凿鑿 枣棗 灶竈 责責 择擇 则則
+泽澤 贼賊 赠贈 轧軋 铡鍘 闸閘 诈詐 斋齋 债債 毡氈 盏盞 斩斬 辗輾 崭嶄
+栈棧 战戰 绽綻 张張 涨漲 帐帳 账賬 胀脹 赵趙 蛰蟄 辙轍 锗鍺 这這 贞貞
+针針 侦偵 诊診 镇鎮 阵陣 挣掙 睁睜 狰猙 争爭 帧幀 郑鄭 证證 织織 职職
+执執 纸紙 挚摯 掷擲 帜幟 质質 滞滯 钟鐘 终終 种種 肿腫 众眾 诌謅 轴軸
+皱皺 昼晝 骤驟 猪豬 诸諸 诛誅 烛燭 瞩矚 嘱囑 贮貯 铸鑄 筑築 驻駐 专專
+砖磚 转轉 赚賺 桩樁 庄莊 装裝 妆妝 壮壯 状狀 锥錐 赘贅 坠墜 缀綴 谆諄
+准準 浊濁 兹茲 资資 渍漬 综綜 总總 纵縱 邹鄒 诅詛 组組 钻鑽
+兑兌 决決 删刪 刹剎 剥剝 态態 抛拋 捣搗 柜櫃 潇瀟 爱愛 玺璽 珑瓏 皑皚
+踪蹤 鹅鵝 莱萊 岚嵐 岘峴 雏雛 觊覬 丢丟 伥倀 俦儔 俨儼 俪儷
+傥儻 傧儐 兖兗 冁囅 冢塚 凫鳧 刍芻 刭剄 刿劌 剀剴 剐剮 劢勱 泸瀘 浔潯
+荥滎 郸鄲 滢瀅 濑瀨 晖暉 炜煒 玮瑋 琏璉 缙縉 绮綺 骥驥 鲲鯤 鹭鷺
+鸾鸞 鹦鸚 鹉鵡 鲨鯊 鳄鱷 鲫鯽 鲛鮫 鳝鱔 鲢鰱 鳕鱈 鲑鮭 鲶鯰
+钜鉅 麸麩 黉黌 黩黷 龛龕 龌齷 龊齪 躏躪 颦顰 馕饢 骜驁 谧謐 谪謫 诘詰 诙詼
+`
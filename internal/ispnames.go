@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// How an ISP name entry matches the ISPs of the databases.
+const (
+	ISPMatchExact  = "exact"
+	ISPMatchNoCase = "nocase"
+	ISPMatchRegexp = "regex"
+)
+
+// ispNamesLanguage is the language of the compiled names, and of the
+// entries of a file that have none.
+const ispNamesLanguage = "zh-CN"
+
+// ispRule is a regex entry of an ISP dictionary. Its name may refer to the
+// groups of the pattern as in regexp.Regexp.Expand.
+type ispRule struct {
+	pattern *regexp.Regexp
+	name    string
+}
+
+// ispDictionary translates the English ISP names of the databases, by
+// language.
+type ispDictionary struct {
+	exact  map[string]map[string]string
+	nocase map[string]map[string]string
+	rules  map[string][]ispRule
+	// english maps the zh-CN exact names back to the English ones, the
+	// smallest one when several share a name, and vocabulary holds the
+	// zh-CN exact names longest first.
+	english    map[string]string
+	vocabulary []string
+}
+
+// newISPDictionary returns a dictionary of the compiled names.
+func newISPDictionary() *ispDictionary {
+	d := &ispDictionary{
+		exact:  map[string]map[string]string{ispNamesLanguage: make(map[string]string, len(ispName))},
+		nocase: make(map[string]map[string]string),
+		rules:  make(map[string][]ispRule),
+	}
+	for en, zh := range ispName {
+		d.exact[ispNamesLanguage][en] = zh
+	}
+	return d
+}
+
+// compile builds the reverse lookups once the entries are in.
+func (d *ispDictionary) compile() {
+	d.english = make(map[string]string)
+	for en, zh := range d.exact[ispNamesLanguage] {
+		if current, ok := d.english[zh]; !ok || en < current {
+			d.english[zh] = en
+		}
+	}
+	d.vocabulary = make([]string, 0, len(d.english))
+	for zh := range d.english {
+		if zh != "" {
+			d.vocabulary = append(d.vocabulary, zh)
+		}
+	}
+	// longest first, so that the most specific name wins
+	sort.Slice(d.vocabulary, func(i, j int) bool {
+		if len(d.vocabulary[i]) != len(d.vocabulary[j]) {
+			return len(d.vocabulary[i]) > len(d.vocabulary[j])
+		}
+		return d.vocabulary[i] < d.vocabulary[j]
+	})
+}
+
+// translate returns the name of isp in lang: an exact entry, else a case
+// insensitive one, else the first regex one that matches all of isp.
+func (d *ispDictionary) translate(isp, lang string) (string, bool) {
+	if name, ok := d.exact[lang][isp]; ok {
+		return name, true
+	}
+	if name, ok := d.nocase[lang][strings.ToLower(isp)]; ok {
+		return name, true
+	}
+	for _, rule := range d.rules[lang] {
+		if match := rule.pattern.FindStringSubmatchIndex(isp); match != nil {
+			return string(rule.pattern.ExpandString(nil, rule.name, isp, match)), true
+		}
+	}
+	return "", false
+}
+
+func (d *ispDictionary) add(row map[string]string) error {
+	isp, lang, name := row["isp"], CanonicalLanguage(row["lang"]), row["name"]
+	if isp == "" || name == "" {
+		return fmt.Errorf("missing isp or name")
+	}
+	match := row["match"]
+	if match == "" {
+		match = ISPMatchExact
+	}
+	switch match {
+	case ISPMatchExact:
+		if d.exact[lang] == nil {
+			d.exact[lang] = make(map[string]string)
+		}
+		d.exact[lang][isp] = name
+	case ISPMatchNoCase:
+		if d.nocase[lang] == nil {
+			d.nocase[lang] = make(map[string]string)
+		}
+		d.nocase[lang][strings.ToLower(isp)] = name
+	case ISPMatchRegexp:
+		// the pattern must match a whole name
+		pattern, err := regexp.Compile("^(?:" + isp + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", isp, err)
+		}
+		d.rules[lang] = append(d.rules[lang], ispRule{pattern: pattern, name: name})
+	default:
+		return fmt.Errorf("unknown match %q, expected exact, nocase or regex", match)
+	}
+	return nil
+}
+
+// ispNames is the dictionary in use, the compiled one until an ISPNames
+// file is loaded.
+var ispNames atomic.Pointer[ispDictionary]
+
+func init() {
+	d := newISPDictionary()
+	d.compile()
+	ispNames.Store(d)
+}
+
+// ISPNames is a file of ISP name translations, merged over the compiled
+// ones and replaced as a whole by Reload. Every lookup uses the file last
+// loaded.
+//
+// A CSV file has a header row naming its columns: isp, the English name as
+// in the databases; lang, empty for zh-CN; name, the translation; and the
+// optional match, one of exact (the default), nocase or regex, where isp
+// is a pattern that must match the whole name. A JSON file is an array of
+// objects with the same keys.
+type ISPNames struct {
+	Path string
+}
+
+func NewISPNames(path string) (*ISPNames, error) {
+	n := &ISPNames{Path: path}
+	if err := n.Reload(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Reload reads the file again. The translations in use are kept if it
+// cannot be read.
+func (n *ISPNames) Reload() error {
+	rows, err := readRows(n.Path)
+	if err != nil {
+		return err
+	}
+
+	d := newISPDictionary()
+	for i, row := range rows {
+		if row["lang"] == "" {
+			row["lang"] = ispNamesLanguage
+		}
+		if err := d.add(row); err != nil {
+			return fmt.Errorf("%s: entry %d: %w", n.Path, i+1, err)
+		}
+	}
+	d.compile()
+	ispNames.Store(d)
+	return nil
+}
+
+// readRows reads the entries of a CSV file, or of a JSON one when its
+// extension is .json, keyed by their column names.
+func readRows(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []map[string]string
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		rows, err = readJSONRows(f)
+	} else {
+		rows, err = readCSVRows(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rows, nil
+}
+
+// readJSONRows reads an array of objects whose values are strings or
+// numbers.
+func readJSONRows(r io.Reader) ([]map[string]string, error) {
+	var values []map[string]any
+	if err := json.NewDecoder(r).Decode(&values); err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]string, len(values))
+	for i, entry := range values {
+		rows[i] = make(map[string]string, len(entry))
+		for key, value := range entry {
+			switch v := value.(type) {
+			case string:
+				rows[i][key] = v
+			case float64:
+				rows[i][key] = strconv.FormatFloat(v, 'f', -1, 64)
+			case nil:
+			default:
+				return nil, fmt.Errorf("entry %d: %s must be a string or a number", i+1, key)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// readCSVRows reads the rows of a CSV file with a header, keyed by their
+// column names. Lines starting with # are comments.
+func readCSVRows(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(record) {
+				row[strings.TrimSpace(column)] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// keepISPNames restores the ISP names in use once the test is done.
+func keepISPNames(t *testing.T) {
+	t.Helper()
+	saved := ispNames.Load()
+	t.Cleanup(func() { ispNames.Store(saved) })
+}
+
+func TestISPDictionaryTranslate(t *testing.T) {
+	d := newISPDictionary()
+	for _, row := range []map[string]string{
+		{"isp": "Acme Networks", "name": "阿克米网络"},
+		{"isp": "acme networks", "name": "阿克米（不分大小写）", "match": ISPMatchNoCase},
+		{"isp": "Acme .*", "name": "阿克米（正则）", "match": ISPMatchRegexp},
+		{"isp": "ACME BROADBAND", "name": "阿克米宽带", "match": ISPMatchNoCase},
+		{"isp": "Acme (\\w+) Cloud", "name": "阿克米$1云", "match": ISPMatchRegexp},
+		{"isp": "Acme Broadband .*", "name": "阿克米宽带（正则）", "match": ISPMatchRegexp},
+		{"isp": "Cloud", "name": "云", "match": ISPMatchRegexp},
+		// an entry of the file replaces the compiled one
+		{"isp": "China Mobile", "name": "中国移动"},
+		{"isp": "Acme Networks", "lang": "zh-tw", "name": "阿克米網路"},
+		{"isp": "Acme .*", "lang": "ja", "name": "アクメ", "match": ISPMatchRegexp},
+	} {
+		if err := d.add(row); err != nil {
+			t.Fatalf("%v: %v", row, err)
+		}
+	}
+	d.compile()
+
+	tests := []struct {
+		isp, lang string
+		want      string
+	}{
+		// exact, then case insensitive, then regex
+		{isp: "Acme Networks", lang: "zh-CN", want: "阿克米网络"},
+		{isp: "ACME NETWORKS", lang: "zh-CN", want: "阿克米（不分大小写）"},
+		{isp: "Acme Hosting", lang: "zh-CN", want: "阿克米（正则）"},
+		{isp: "acme broadband", lang: "zh-CN", want: "阿克米宽带"},
+		// the first regex that matches wins
+		{isp: "Acme Broadband Fiber", lang: "zh-CN", want: "阿克米（正则）"},
+		{isp: "Acme Edge Cloud", lang: "zh-CN", want: "阿克米（正则）"},
+		// a regex matches the whole name only
+		{isp: "Big Cloud", lang: "zh-CN"},
+		{isp: "Cloud", lang: "zh-CN", want: "云"},
+		{isp: "China Mobile", lang: "zh-CN", want: "中国移动"},
+		{isp: "China Telecom", lang: "zh-CN", want: "电信"},
+		// entries are by language
+		{isp: "Acme Networks", lang: "zh-TW", want: "阿克米網路"},
+		{isp: "ACME NETWORKS", lang: "zh-TW"},
+		{isp: "Acme Hosting", lang: "ja", want: "アクメ"},
+		{isp: "China Telecom", lang: "ja"},
+	}
+	for _, tt := range tests {
+		name, ok := d.translate(tt.isp, tt.lang)
+		if name != tt.want || ok != (tt.want != "") {
+			t.Errorf("translate(%q, %s) = %q, %v, want %q", tt.isp, tt.lang, name, ok, tt.want)
+		}
+	}
+
+	// the reverse lookups are built from the zh-CN exact names
+	if en := d.english["中国移动"]; en != "China Mobile" {
+		t.Errorf("english[中国移动] = %q", en)
+	}
+	if en, ok := d.english["阿克米（不分大小写）"]; ok {
+		t.Errorf("a nocase name is in the reverse lookup as %q", en)
+	}
+}
+
+func TestISPDictionaryAddInvalid(t *testing.T) {
+	tests := []struct {
+		row map[string]string
+		err string
+	}{
+		{row: map[string]string{"isp": "Acme"}, err: "missing isp or name"},
+		{row: map[string]string{"name": "阿克米"}, err: "missing isp or name"},
+		{row: map[string]string{"isp": "Acme (", "name": "阿克米", "match": ISPMatchRegexp}, err: "invalid pattern"},
+		{row: map[string]string{"isp": "Acme", "name": "阿克米", "match": "prefix"}, err: `unknown match "prefix"`},
+	}
+	for _, tt := range tests {
+		if err := newISPDictionary().add(tt.row); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("add(%v) = %v, want an error containing %q", tt.row, err, tt.err)
+		}
+	}
+}
+
+func TestISPNamesReload(t *testing.T) {
+	keepISPNames(t)
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	translated := func(isp string) string {
+		name, _ := translateISP(isp, "zh-CN")
+		return name
+	}
+
+	// the compiled names stay in use when the first file cannot be loaded
+	if _, err := NewISPNames(write("invalid.csv", "isp,name,match\nAcme (,阿克米,regex\n")); err == nil {
+		t.Fatal("an invalid pattern was loaded")
+	}
+	if _, err := NewISPNames(filepath.Join(dir, "missing.csv")); err == nil {
+		t.Fatal("a missing file was loaded")
+	}
+	if got := translated("China Mobile"); got != "移动" {
+		t.Errorf("China Mobile = %q after failed loads, want the compiled 移动", got)
+	}
+
+	path := write("isp.csv", "isp,lang,name\nChina Mobile,,中国移动\nAcme Networks,,阿克米网络\n")
+	names, err := NewISPNames(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := translated("China Mobile/Acme Networks"); got != "中国移动/阿克米网络" {
+		t.Errorf("translated = %q", got)
+	}
+
+	// a failed reload keeps the file last loaded
+	write("isp.csv", "isp,lang,name\nChina Mobile,,\n")
+	if err := names.Reload(); err == nil || !strings.Contains(err.Error(), "entry 1") {
+		t.Errorf("Reload() = %v, want an error for entry 1", err)
+	}
+	if got := translated("Acme Networks"); got != "阿克米网络" {
+		t.Errorf("Acme Networks = %q after a failed reload", got)
+	}
+
+	write("isp.csv", "isp,name\nAcme Networks,阿克米\n")
+	if err := names.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := translated("Acme Networks"); got != "阿克米" {
+		t.Errorf("Acme Networks = %q after a reload", got)
+	}
+	// the file is merged over the compiled names, not over the last file
+	if got := translated("China Mobile"); got != "移动" {
+		t.Errorf("China Mobile = %q, want the compiled 移动", got)
+	}
+}
@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+	"golang.org/x/text/language"
+)
+
+// DefaultLanguage is the language of the answers when none is asked for.
+const DefaultLanguage = "zh-CN"
+
+var (
+	fallbacksMu sync.RWMutex
+	// fallbacks maps a language to the ones tried after it for names a
+	// record does not have in that language.
+	fallbacks = make(map[string][]string)
+)
+
+// The chains of the languages compact records carry when no fallback is set
+// for them; they are shared so that building them does not allocate.
+var (
+	enChain   = []string{"en", "zh-CN"}
+	zhCNChain = []string{"zh-CN", "en"}
+	zhTWChain = []string{LanguageTaiwan, "zh-CN", "en"}
+	zhHKChain = []string{LanguageHongKong, "zh-CN", "en"}
+)
+
+// CanonicalLanguage returns lang as records name it, such as zh-CN for
+// zh-cn, DefaultLanguage for "", and lang itself when it is not a valid
+// language tag.
+func CanonicalLanguage(lang string) string {
+	if lang == "" {
+		return DefaultLanguage
+	}
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return lang
+	}
+	return tag.String()
+}
+
+// SetLanguageFallback sets the languages tried, in order, for the names a
+// record does not have in a language. spec is language=fallback,fallback,
+// such as zh-TW=zh-CN,en. English then Chinese are tried last anyway, or
+// Chinese then English for the Traditional Chinese languages.
+func SetLanguageFallback(spec string) error {
+	lang, list, ok := strings.Cut(spec, "=")
+	if !ok || strings.TrimSpace(lang) == "" {
+		return fmt.Errorf("%s is not in the form language=fallback,fallback", spec)
+	}
+	var chain []string
+	for _, fallback := range strings.Split(list, ",") {
+		if fallback = strings.TrimSpace(fallback); fallback != "" {
+			chain = append(chain, CanonicalLanguage(fallback))
+		}
+	}
+	fallbacksMu.Lock()
+	fallbacks[CanonicalLanguage(strings.TrimSpace(lang))] = chain
+	fallbacksMu.Unlock()
+	return nil
+}
+
+// languageChain returns the languages to try for the names of an answer in
+// lang: lang, its fallbacks, then English and Chinese. The Traditional
+// Chinese languages try Chinese before English, as their zh-CN names are
+// converted.
+func languageChain(lang string) []string {
+	lang = CanonicalLanguage(lang)
+	fallbacksMu.RLock()
+	configured, ok := fallbacks[lang]
+	fallbacksMu.RUnlock()
+	if !ok {
+		switch lang {
+		case "en":
+			return enChain
+		case "zh-CN":
+			return zhCNChain
+		case LanguageTaiwan:
+			return zhTWChain
+		case LanguageHongKong:
+			return zhHKChain
+		}
+	}
+	last := enChain
+	if isTraditional(lang) {
+		last = zhCNChain
+	}
+	chain := []string{lang}
+	for _, list := range [][]string{configured, last} {
+		for _, l := range list {
+			if !containsString(chain, l) {
+				chain = append(chain, l)
+			}
+		}
+	}
+	return chain
+}
+
+// compactChain reports whether compact records, which only carry en and
+// zh-CN names, answer like full ones for chain: every other language of
+// chain is one the database, of the given languages, has no names in.
+func compactChain(chain []string, available []string) bool {
+	for _, lang := range chain {
+		if lang != "en" && lang != "zh-CN" && containsString(available, lang) {
+			return false
+		}
+	}
+	return true
+}
+
+// FieldLanguages tells the language each name of an IPInfo is in. A field
+// is empty when the name is, or when an override without a language set it.
+type FieldLanguages struct {
+	Continent string `json:"continent,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Region    string `json:"region,omitempty"`
+	City      string `json:"city,omitempty"`
+	ISP       string `json:"isp,omitempty"`
+	UserType  string `json:"user_type,omitempty"`
+}
+
+// set records lang for the IPInfo field named as in its json tag, if it
+// is a name.
+func (l *FieldLanguages) set(field, lang string) {
+	switch field {
+	case "continent":
+		l.Continent = lang
+	case "country":
+		l.Country = lang
+	case "region":
+		l.Region = lang
+	case "city":
+		l.City = lang
+	case "isp":
+		l.ISP = lang
+	case "user_type":
+		l.UserType = lang
+	}
+}
+
+// localizedName returns the name of the place geoNameID in the first
+// language of chain that names or the place names have and that language,
+// or any name rather than none.
+func localizedName(geoNameID uint, names map[string]string, chain []string) (string, string) {
+	for _, lang := range chain {
+		if v := names[lang]; v != "" {
+			return toTraditional(v, lang, chain)
+		}
+		if v, ok := placeName(geoNameID, lang); ok {
+			return toTraditional(v, lang, chain)
+		}
+	}
+	langs := make([]string, 0, len(names))
+	for lang, v := range names {
+		if v != "" {
+			langs = append(langs, lang)
+		}
+	}
+	if len(langs) == 0 {
+		return "", ""
+	}
+	// the same one every time
+	sort.Strings(langs)
+	return names[langs[0]], langs[0]
+}
+
+func compactName(geoNameID uint, names geoip2.LocalizedNames, chain []string) (string, string) {
+	for _, lang := range chain {
+		switch {
+		case lang == "en" && names.En != "":
+			return names.En, lang
+		case lang == "zh-CN" && names.ZhCN != "":
+			return toTraditional(names.ZhCN, lang, chain)
+		}
+		if v, ok := placeName(geoNameID, lang); ok {
+			return toTraditional(v, lang, chain)
+		}
+	}
+	return "", ""
+}
+
+// noteUntranslated notes the place geoNameID of field as untranslated in
+// info when its name, in lang, is not in the first language of chain.
+func (info *IPInfo) noteUntranslated(field string, geoNameID uint, chain []string, lang string) {
+	if geoNameID == 0 || lang == chain[0] {
+		return
+	}
+	var name string
+	switch field {
+	case "continent":
+		name = info.Continent
+	case "country":
+		name = info.Country
+	case "region":
+		name = info.Region
+	case "city":
+		name = info.City
+	}
+	info.untranslated = append(info.untranslated, UntranslatedPlace{
+		GeoNameID: geoNameID,
+		Lang:      chain[0],
+		Field:     field,
+		Name:      name,
+		NameLang:  lang,
+	})
+}
+
+// FallbackLanguages returns the languages SetLanguageFallback set fallbacks
+// for, sorted.
+func FallbackLanguages() []string {
+	fallbacksMu.RLock()
+	defer fallbacksMu.RUnlock()
+	langs := make([]string, 0, len(fallbacks))
+	for lang := range fallbacks {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
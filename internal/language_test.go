@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+// setFallbacks replaces the fallbacks with the ones of specs for the
+// duration of the test.
+func setFallbacks(t *testing.T, specs ...string) {
+	t.Helper()
+	fallbacksMu.Lock()
+	saved := fallbacks
+	fallbacks = make(map[string][]string)
+	fallbacksMu.Unlock()
+	t.Cleanup(func() {
+		fallbacksMu.Lock()
+		fallbacks = saved
+		fallbacksMu.Unlock()
+	})
+	for _, spec := range specs {
+		if err := SetLanguageFallback(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCanonicalLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":           DefaultLanguage,
+		"zh-cn":      "zh-CN",
+		"EN":         "en",
+		"pt-br":      "pt-BR",
+		"zh_TW":      "zh-TW",
+		"not a tag!": "not a tag!",
+	}
+	for lang, want := range tests {
+		if got := CanonicalLanguage(lang); got != want {
+			t.Errorf("CanonicalLanguage(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
+
+func TestSetLanguageFallbackInvalid(t *testing.T) {
+	setFallbacks(t)
+	for _, spec := range []string{"zh-TW", "=en", " =en"} {
+		if err := SetLanguageFallback(spec); err == nil {
+			t.Errorf("SetLanguageFallback(%q): no error", spec)
+		}
+	}
+	if langs := FallbackLanguages(); len(langs) != 0 {
+		t.Errorf("fallbacks set for %q", langs)
+	}
+}
+
+func TestLanguageChain(t *testing.T) {
+	tests := []struct {
+		lang      string
+		fallbacks []string
+		chain     string
+	}{
+		{lang: "en", chain: "en,zh-CN"},
+		{lang: "", chain: "zh-CN,en"},
+		{lang: "zh-cn", chain: "zh-CN,en"},
+		{lang: "zh-TW", chain: "zh-TW,zh-CN,en"},
+		{lang: "zh-HK", chain: "zh-HK,zh-CN,en"},
+		{lang: "de", chain: "de,en,zh-CN"},
+		{lang: "de", fallbacks: []string{"de=fr, en"}, chain: "de,fr,en,zh-CN"},
+		{lang: "zh-TW", fallbacks: []string{"zh-TW=en"}, chain: "zh-TW,en,zh-CN"},
+		{lang: "zh-HK", fallbacks: []string{"zh-hk=zh-tw"}, chain: "zh-HK,zh-TW,zh-CN,en"},
+		{lang: "ja", fallbacks: []string{"ja=ja,zh-cn"}, chain: "ja,zh-CN,en"},
+		{lang: "en", fallbacks: []string{"en="}, chain: "en,zh-CN"},
+		{lang: "fr", fallbacks: []string{"de=es"}, chain: "fr,en,zh-CN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+strings.Join(tt.fallbacks, ";"), func(t *testing.T) {
+			setFallbacks(t, tt.fallbacks...)
+			if got := strings.Join(languageChain(tt.lang), ","); got != tt.chain {
+				t.Errorf("languageChain(%q) = %s, want %s", tt.lang, got, tt.chain)
+			}
+		})
+	}
+}
+
+func TestCompactChain(t *testing.T) {
+	available := []string{"en", "zh-CN", "de", "fr"}
+	tests := []struct {
+		chain []string
+		want  bool
+	}{
+		{chain: []string{"en", "zh-CN"}, want: true},
+		{chain: []string{"zh-TW", "zh-CN", "en"}, want: true},
+		{chain: []string{"ja", "en", "zh-CN"}, want: true},
+		{chain: []string{"de", "en", "zh-CN"}, want: false},
+		{chain: []string{"ja", "fr", "en"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := compactChain(tt.chain, available); got != tt.want {
+			t.Errorf("compactChain(%q) = %v, want %v", tt.chain, got, tt.want)
+		}
+	}
+}
+
+func TestLocalizedName(t *testing.T) {
+	names := map[string]string{"en": "Shenyang", "zh-CN": "沈阳", "de": "Shenyang (de)"}
+	tests := []struct {
+		name  string
+		names map[string]string
+		chain []string
+		want  string
+		lang  string
+	}{
+		{name: "first", names: names, chain: []string{"de", "en", "zh-CN"}, want: "Shenyang (de)", lang: "de"},
+		{name: "fallback", names: names, chain: []string{"ru", "en", "zh-CN"}, want: "Shenyang", lang: "en"},
+		{name: "chinese", names: names, chain: []string{"zh-CN", "en"}, want: "沈阳", lang: "zh-CN"},
+		{name: "traditional", names: names, chain: []string{"zh-TW", "zh-CN", "en"}, want: "瀋陽", lang: "zh-TW"},
+		{name: "traditional name", names: map[string]string{"zh-TW": "台北", "zh-CN": "台北"}, chain: []string{"zh-TW", "zh-CN", "en"}, want: "台北", lang: "zh-TW"},
+		{name: "outside the chain", names: map[string]string{"ja": "瀋陽市", "fr": "Moukden"}, chain: []string{"en", "zh-CN"}, want: "Moukden", lang: "fr"},
+		{name: "empty names", names: map[string]string{"en": ""}, chain: []string{"en", "zh-CN"}},
+		{name: "none", chain: []string{"en", "zh-CN"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, lang := localizedName(0, tt.names, tt.chain)
+			if got != tt.want || lang != tt.lang {
+				t.Errorf("localizedName = %q, %q, want %q, %q", got, lang, tt.want, tt.lang)
+			}
+		})
+	}
+}
+
+func TestGetIPInfoLanguages(t *testing.T) {
+	var record Record
+	record.Continent.Names = map[string]string{"en": "Asia", "zh-CN": "亚洲", "de": "Asien"}
+	record.Country.Names = map[string]string{"en": "China", "zh-CN": "中国", "de": "China (de)"}
+	record.City.Names = map[string]string{"en": "Shenyang", "zh-CN": "沈阳"}
+	record.Subdivisions = subdivisionsOf("en", "Liaoning", "Shenyang")
+
+	tests := []struct {
+		lang      string
+		fallbacks []string
+		country   string
+		languages FieldLanguages
+	}{
+		{lang: "de", country: "China (de)", languages: FieldLanguages{Continent: "de", Country: "de", Region: "en", City: "en"}},
+		{lang: "ru", country: "China", languages: FieldLanguages{Continent: "en", Country: "en", Region: "en", City: "en"}},
+		{lang: "ru", fallbacks: []string{"ru=zh-CN"}, country: "中国", languages: FieldLanguages{Continent: "zh-CN", Country: "zh-CN", Region: "en", City: "en"}},
+		{lang: "zh-TW", country: "中國", languages: FieldLanguages{Continent: "zh-TW", Country: "zh-TW", Region: "en", City: "en"}},
+		{lang: "zh-TW", fallbacks: []string{"zh-TW=de"}, country: "China (de)", languages: FieldLanguages{Continent: "de", Country: "de", Region: "en", City: "en"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+strings.Join(tt.fallbacks, ";"), func(t *testing.T) {
+			setFallbacks(t, tt.fallbacks...)
+			info := GetIPInfoFromLocationISP(&record, tt.lang)
+			if info.Country != tt.country {
+				t.Errorf("country = %q, want %q", info.Country, tt.country)
+			}
+			tt.languages.ISP = info.Languages.ISP
+			tt.languages.UserType = info.Languages.UserType
+			if info.Languages != tt.languages {
+				t.Errorf("languages = %+v, want %+v", info.Languages, tt.languages)
+			}
+		})
+	}
+}
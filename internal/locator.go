@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Record is the normalized record every Locator returns. It keeps the shape
+// of the dbip's `IP to Location + ISP` record, which /v1/report serves as is,
+// so backends that read other formats fill in the fields they have.
+type Record = geoip2.LocationISP
+
+// A Locator finds where an address is. Implementations must be safe for
+// concurrent use.
+type Locator interface {
+	// Lookup returns the full record of addr.
+	Lookup(addr netip.Addr) (*Record, error)
+	// LookupIPInfo returns the info of addr localized in lang.
+	LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error)
+	// Databases describes the databases in use.
+	Databases() []DatabaseInfo
+	// Close releases the resources held by the Locator.
+	Close() error
+}
+
+// DatabaseInfo describes a database a Locator reads from, in the terms of
+// the metadata of an mmdb file. BuildEpoch is 0 when the build date of the
+// file is unknown.
+type DatabaseInfo struct {
+	Role         string
+	Path         string
+	DatabaseType string
+	BuildEpoch   uint
+	Languages    []string
+	IPVersion    uint
+	// The following are only known for mmdb files.
+	NodeCount           uint
+	RecordSize          uint
+	BinaryFormatVersion string
+	Description         map[string]string
+}
@@ -0,0 +1,400 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// The roles a database can have in a Merged locator.
+const (
+	RoleLocation    = "location"
+	RoleASN         = "asn"
+	RoleAnonymousIP = "anonymous-ip"
+)
+
+// Source is one database of a Merged locator. Its reader can be replaced
+// at any time with Open, which is how every file is hot-reloaded on its
+// own.
+type Source struct {
+	Role    string
+	Path    string
+	Options OpenOptions
+	reader  sharedHolder[*geoip2.Reader]
+}
+
+// ParseSource parses a database given as `role=path`. A bare path is a
+// location database.
+func ParseSource(spec string) (*Source, error) {
+	role, path, ok := strings.Cut(spec, "=")
+	if !ok {
+		role, path = RoleLocation, spec
+	}
+	switch role {
+	case RoleLocation, RoleASN, RoleAnonymousIP:
+	default:
+		return nil, fmt.Errorf("unknown database role %q in %s", role, spec)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("missing database path in %s", spec)
+	}
+	return &Source{Role: role, Path: path}, nil
+}
+
+// Open opens the database at s.Path with s.Options and, when it passes
+// verification and can serve the role of the source, makes it the one the
+// source reads from. The reader it replaces is closed once the lookups in
+// flight on it are done.
+func (s *Source) Open() error {
+	reader, err := OpenDB(s.Path, s.Options)
+	if err != nil {
+		return err
+	}
+	if err := probe(reader, s.Role); err != nil {
+		reader.Close()
+		return fmt.Errorf("%s cannot be used as %s database: %w", s.Path, s.Role, err)
+	}
+	s.reader.store(reader, (*geoip2.Reader).Close)
+	return nil
+}
+
+// Reader returns the reader the source currently reads from, nil before
+// it is opened, for its metadata. Lookups go through Acquire, since the
+// reader may be closed once the source is reloaded.
+func (s *Source) Reader() *geoip2.Reader {
+	reader, _ := s.reader.load()
+	return reader
+}
+
+// Acquire returns the reader the source currently reads from, which stays
+// open until release is called even if the source is reloaded meanwhile.
+func (s *Source) Acquire() (reader *geoip2.Reader, release func(), err error) {
+	r, err := s.reader.acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.value, r.release, nil
+}
+
+// probe makes a lookup of the kind the role needs, so that a database of
+// the wrong type is rejected when it is opened rather than on every request.
+func probe(reader *geoip2.Reader, role string) error {
+	var invalid geoip2.InvalidMethodError
+	var err error
+	switch role {
+	case RoleLocation:
+		_, _, err = reader.LocationISPAddr(netip.IPv4Unspecified())
+	case RoleASN:
+		_, err = reader.ASNAddr(netip.IPv4Unspecified())
+	case RoleAnonymousIP:
+		_, err = reader.AnonymousIPAddr(netip.IPv4Unspecified())
+	}
+	if errors.As(err, &invalid) {
+		return err
+	}
+	return nil
+}
+
+// Merged is the Locator that queries several databases and merges their
+// answers into one. Precedence is defined per role:
+//
+//   - location and ISP come from the first location database, in the order
+//     the sources were given, that knows the country of the address;
+//   - the ASN comes from the first asn database that knows it, falling back
+//     to the one in the location record;
+//   - the anonymizer flags come from the first anonymous-ip database that
+//     flags the address.
+type Merged struct {
+	sources []*Source
+	cache   *IPInfoCache
+}
+
+// NewMerged returns a Merged locator over sources, which must have been
+// opened already. At least one location database is required. Answers are
+// cached in cacheSize entries; 0 disables the cache.
+func NewMerged(sources []*Source, cacheSize int) (*Merged, error) {
+	hasLocation := false
+	for _, s := range sources {
+		if s.Reader() == nil {
+			return nil, fmt.Errorf("database %s has not been opened", s.Path)
+		}
+		hasLocation = hasLocation || s.Role == RoleLocation
+	}
+	if !hasLocation {
+		return nil, errors.New("at least one location database is required")
+	}
+	m := &Merged{sources: sources}
+	if cacheSize > 0 {
+		m.cache = NewIPInfoCache(cacheSize)
+	}
+	return m, nil
+}
+
+// Sources returns the databases of the locator, in order of precedence.
+func (m *Merged) Sources() []*Source {
+	return m.sources
+}
+
+// Databases describes the databases of the locator from their metadata, in
+// order of precedence.
+func (m *Merged) Databases() []DatabaseInfo {
+	databases := make([]DatabaseInfo, 0, len(m.sources))
+	for _, s := range m.sources {
+		reader := s.Reader()
+		if reader == nil {
+			continue
+		}
+		databases = append(databases, mmdbInfo(s.Role, s.Path, reader))
+	}
+	return databases
+}
+
+// Reload opens the file of source again, which must be one of the sources
+// of m, then flushes the cache. The database it replaced is closed once
+// the lookups in flight are done. The database in use is kept if the new
+// one cannot be opened or fails verification.
+func (m *Merged) Reload(source *Source) error {
+	if err := source.Open(); err != nil {
+		return err
+	}
+	if m.cache != nil {
+		m.cache.Flush()
+	}
+	return nil
+}
+
+// FlushCache empties the answer cache, for when something the answers are
+// made of besides the databases changed.
+func (m *Merged) FlushCache() {
+	if m.cache != nil {
+		m.cache.Flush()
+	}
+}
+
+// CacheStats returns the counters of the answer cache, or false when the
+// cache is disabled.
+func (m *Merged) CacheStats() (CacheStats, bool) {
+	if m.cache == nil {
+		return CacheStats{}, false
+	}
+	return m.cache.Stats(), true
+}
+
+// Lookup answers from the cache when it can, under the network key of
+// LookupIPInfo. The record may be shared and must not be modified.
+func (m *Merged) Lookup(addr netip.Addr) (*Record, error) {
+	var generation *cacheGeneration
+	if m.cache != nil {
+		generation = m.cache.current()
+	}
+	network, err := m.network(addr)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{network: network, record: true}
+	if m.cache != nil {
+		if record, ok := m.cache.get(generation, key); ok {
+			return record.(*Record), nil
+		}
+	}
+	record, err := m.lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	if m.cache != nil {
+		m.cache.add(generation, key, record)
+	}
+	return record, nil
+}
+
+func (m *Merged) lookup(addr netip.Addr) (*Record, error) {
+	var record *Record
+	for _, s := range m.sources {
+		if s.Role != RoleLocation {
+			continue
+		}
+		r, err := s.reader.acquire()
+		if err != nil {
+			return nil, err
+		}
+		info, err := GetIPInfoByAddr(addr, r.value)
+		r.release()
+		if err != nil {
+			return nil, err
+		}
+		if record == nil || record.Country.IsoCode == "" {
+			record = info
+		}
+		if record.Country.IsoCode != "" {
+			break
+		}
+	}
+
+	asn, anonymous, err := m.lookupExtras(addr)
+	if err != nil {
+		return nil, err
+	}
+	if asn != nil {
+		record.Traits.AutonomousSystemNumber = asn.AutonomousSystemNumber
+		record.Traits.AutonomousSystemOrganization = asn.AutonomousSystemOrganization
+	}
+	if anonymous != nil {
+		record.Traits.IsAnonymous = anonymous.IsAnonymous
+		record.Traits.IsAnonymousVPN = anonymous.IsAnonymousVPN
+		record.Traits.IsHostingProvider = anonymous.IsHostingProvider
+		record.Traits.IsPublicProxy = anonymous.IsPublicProxy
+		record.Traits.IsResidentialProxy = anonymous.IsResidentialProxy
+		record.Traits.IsTorExitNode = anonymous.IsTorExitNode
+	}
+	return record, nil
+}
+
+// LookupIPInfo answers from the cache when it can, see network. Every
+// answer counts toward UntranslatedPlaces.
+func (m *Merged) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	// the generation is loaded before the readers, see IPInfoCache.Flush
+	var generation *cacheGeneration
+	if m.cache != nil {
+		generation = m.cache.current()
+	}
+	network, err := m.network(addr)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{network: network, lang: lang}
+	if m.cache != nil {
+		if info, ok := m.cache.get(generation, key); ok {
+			countUntranslated(info.(*IPInfo))
+			return info.(*IPInfo), nil
+		}
+	}
+	info, err := m.lookupIPInfo(addr, lang)
+	if err != nil {
+		return nil, err
+	}
+	info.Network = newNetworkRange(network)
+	if m.cache != nil {
+		m.cache.add(generation, key, info)
+	}
+	countUntranslated(info)
+	return info, nil
+}
+
+// network returns the cache key of addr: the most specific of the networks
+// addr is found under in the sources. They all contain addr, so that one
+// is their intersection, and every address in it gets the same answer from
+// every source. It is the network of the answer too.
+func (m *Merged) network(addr netip.Addr) (netip.Prefix, error) {
+	var network netip.Prefix
+	for _, s := range m.sources {
+		r, err := s.reader.acquire()
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		prefix, err := r.value.NetworkAddr(addr)
+		r.release()
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if !network.IsValid() || hostBits(prefix) < hostBits(network) {
+			network = prefix
+		}
+	}
+	return network, nil
+}
+
+// hostBits is the number of bits of the host part of prefix, which is
+// smaller the more specific prefix is whatever its address family.
+func hostBits(prefix netip.Prefix) int {
+	return prefix.Addr().BitLen() - prefix.Bits()
+}
+
+func (m *Merged) lookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	var ipInfo *IPInfo
+	for _, s := range m.sources {
+		if s.Role != RoleLocation {
+			continue
+		}
+		r, err := s.reader.acquire()
+		if err != nil {
+			return nil, err
+		}
+		info, err := LookupIPInfo(addr, r.value, lang)
+		r.release()
+		if err != nil {
+			return nil, err
+		}
+		if ipInfo == nil || ipInfo.CountryCode == "" {
+			ipInfo = info
+		}
+		if ipInfo.CountryCode != "" {
+			break
+		}
+	}
+
+	asn, anonymous, err := m.lookupExtras(addr)
+	if err != nil {
+		return nil, err
+	}
+	if asn != nil {
+		ipInfo.ASN = asn.AutonomousSystemNumber
+		ipInfo.ASOrganization = asn.AutonomousSystemOrganization
+	}
+	if anonymous != nil {
+		ipInfo.Anonymous = &Anonymous{
+			IsAnonymous:        anonymous.IsAnonymous,
+			IsAnonymousVPN:     anonymous.IsAnonymousVPN,
+			IsHostingProvider:  anonymous.IsHostingProvider,
+			IsPublicProxy:      anonymous.IsPublicProxy,
+			IsResidentialProxy: anonymous.IsResidentialProxy,
+			IsTorExitNode:      anonymous.IsTorExitNode,
+		}
+	}
+	return ipInfo, nil
+}
+
+// lookupExtras returns what the asn and anonymous-ip databases know about
+// addr. Either result is nil when no database of that role knows it.
+func (m *Merged) lookupExtras(addr netip.Addr) (*geoip2.ASN, *geoip2.AnonymousIP, error) {
+	var asn *geoip2.ASN
+	var anonymous *geoip2.AnonymousIP
+	for _, s := range m.sources {
+		if !(s.Role == RoleASN && asn == nil) && !(s.Role == RoleAnonymousIP && anonymous == nil) {
+			continue
+		}
+		r, err := s.reader.acquire()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch s.Role {
+		case RoleASN:
+			var val *geoip2.ASN
+			val, err = r.value.ASNAddr(addr)
+			if err == nil && val.AutonomousSystemNumber != 0 {
+				asn = val
+			}
+		case RoleAnonymousIP:
+			var val *geoip2.AnonymousIP
+			val, err = r.value.AnonymousIPAddr(addr)
+			if err == nil && val.IsAnonymous {
+				anonymous = val
+			}
+		}
+		r.release()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return asn, anonymous, nil
+}
+
+// Close closes the databases once the lookups in flight are done.
+func (m *Merged) Close() error {
+	for _, s := range m.sources {
+		s.reader.close()
+	}
+	return nil
+}
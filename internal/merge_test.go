@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/yuryqwer/ip2loc/internal/mmdbtest"
+)
+
+func TestMergedCache(t *testing.T) {
+	location := mmdbtest.New(testLocationType, "en", "zh-CN")
+	location.Insert("1.0.0.0/24", testLocation("CN", "China", "中国", nil))
+	asn := mmdbtest.New("GeoLite2-ASN")
+	asn.Insert("1.0.0.0/25", map[string]any{"autonomous_system_number": 4134})
+	var sources []*Source
+	for _, spec := range []string{writeDB(t, location), RoleASN + "=" + writeDB(t, asn)} {
+		source, err := ParseSource(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := source.Open(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { source.Reader().Close() })
+		sources = append(sources, source)
+	}
+	m, err := NewMerged(sources, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := m.Lookup(netip.MustParseAddr("1.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// within the /25 both databases have
+	second, err := m.Lookup(netip.MustParseAddr("1.0.0.127"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || first.Traits.AutonomousSystemNumber != 4134 {
+		t.Errorf("records = %p %+v, %p %+v, want the same one", first, first.Traits, second, second.Traits)
+	}
+	other, err := m.Lookup(netip.MustParseAddr("1.0.0.128"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first || other.Traits.AutonomousSystemNumber != 0 {
+		t.Errorf("1.0.0.128 answered from the record of 1.0.0.1: %+v", other.Traits)
+	}
+	// records and infos are cached apart
+	info, err := m.LookupIPInfo(netip.MustParseAddr("1.0.0.1"), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Country != "China" || info.Network.CIDR != "1.0.0.0/25" {
+		t.Errorf("info = %+v", info)
+	}
+	stats, _ := m.CacheStats()
+	if stats.Entries != 3 || stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("stats = %+v, want 3 entries, 1 hit and 3 misses", stats)
+	}
+}
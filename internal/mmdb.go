@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// MMDB is the Locator of a bare `IP to Location + ISP` reader, which the
+// golden assertions of Verify are checked against before the reader is
+// served.
+type MMDB struct {
+	reader *geoip2.Reader
+}
+
+func (m *MMDB) Lookup(addr netip.Addr) (*Record, error) {
+	return GetIPInfoByAddr(addr, m.reader)
+}
+
+func (m *MMDB) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	return LookupIPInfo(addr, m.reader, lang)
+}
+
+// Databases describes the file from its metadata.
+func (m *MMDB) Databases() []DatabaseInfo {
+	return []DatabaseInfo{mmdbInfo(RoleLocation, "", m.reader)}
+}
+
+// mmdbInfo describes the mmdb file of reader from its metadata.
+func mmdbInfo(role, path string, reader *geoip2.Reader) DatabaseInfo {
+	meta := reader.Metadata()
+	return DatabaseInfo{
+		Role:                role,
+		Path:                path,
+		DatabaseType:        meta.DatabaseType,
+		BuildEpoch:          meta.BuildEpoch,
+		Languages:           meta.Languages,
+		IPVersion:           meta.IPVersion,
+		NodeCount:           meta.NodeCount,
+		RecordSize:          meta.RecordSize,
+		BinaryFormatVersion: fmt.Sprintf("%d.%d", meta.BinaryFormatMajorVersion, meta.BinaryFormatMinorVersion),
+		Description:         meta.Description,
+	}
+}
+
+func (m *MMDB) Close() error {
+	return m.reader.Close()
+}
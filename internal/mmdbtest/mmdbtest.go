@@ -0,0 +1,287 @@
+// Package mmdbtest writes small mmdb files for tests, so that they do not
+// depend on a database release being around.
+package mmdbtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+// DefaultBuildEpoch is the build date of the databases, 2023-11-14.
+const DefaultBuildEpoch = 1700000000
+
+// Database is an IPv6 mmdb with 24-bit records being built. IPv4 networks
+// are stored under ::/96, like the releases do.
+type Database struct {
+	Type       string
+	Languages  []string
+	BuildEpoch uint64
+	root       *node
+}
+
+type node struct {
+	children [2]*node
+	// record is the data of the network the node is, nil for the nodes in
+	// the middle of the tree.
+	record any
+}
+
+// New returns an empty database of the type, such as
+// `DBIP-Location-ISP (compat=Enterprise)` or `GeoLite2-ASN`.
+func New(databaseType string, languages ...string) *Database {
+	return &Database{
+		Type:       databaseType,
+		Languages:  languages,
+		BuildEpoch: DefaultBuildEpoch,
+		root:       &node{},
+	}
+}
+
+// Insert sets the record of network, which replaces the parts of the
+// networks inserted before it that it covers. The record is made of
+// map[string]any, map[string]string, []any, []string, string, float64,
+// bool, int, uint and uint64 values.
+func (db *Database) Insert(network string, record map[string]any) {
+	prefix := netip.MustParsePrefix(network).Masked()
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4() {
+		bits += 96
+	}
+	ip := addr.As16()
+	if addr.Is4() {
+		ip = [16]byte{}
+		a4 := addr.As4()
+		copy(ip[12:], a4[:])
+	}
+	n := db.root
+	for i := 0; i < bits; i++ {
+		if n.record != nil {
+			// split the network n is into its halves
+			n.children = [2]*node{{record: n.record}, {record: n.record}}
+			n.record = nil
+		}
+		bit := ip[i/8] >> (7 - i%8) & 1
+		if n.children[bit] == nil {
+			n.children[bit] = &node{}
+		}
+		n = n.children[bit]
+	}
+	n.children = [2]*node{}
+	n.record = record
+}
+
+// WriteFile writes the database to path.
+func (db *Database) WriteFile(path string) error {
+	content, err := db.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+// Bytes returns the content of the database file.
+func (db *Database) Bytes() ([]byte, error) {
+	// number the nodes in the middle of the tree breadth first
+	var nodes []*node
+	numbers := make(map[*node]int)
+	queue := []*node{db.root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n.record != nil {
+			continue
+		}
+		numbers[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, child := range n.children {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+	nodeCount := len(nodes)
+
+	var data []byte
+	offsets := make(map[string]int)
+	recordValue := func(n *node) (int, error) {
+		switch {
+		case n == nil:
+			return nodeCount, nil
+		case n.record == nil:
+			return numbers[n], nil
+		}
+		encoded, err := encode(nil, n.record)
+		if err != nil {
+			return 0, err
+		}
+		offset, ok := offsets[string(encoded)]
+		if !ok {
+			offset = len(data)
+			offsets[string(encoded)] = offset
+			data = append(data, encoded...)
+		}
+		return nodeCount + 16 + offset, nil
+	}
+
+	var tree []byte
+	for _, n := range nodes {
+		for _, child := range n.children {
+			value, err := recordValue(child)
+			if err != nil {
+				return nil, err
+			}
+			if value >= 1<<24 {
+				return nil, fmt.Errorf("record value %d does not fit in 24 bits", value)
+			}
+			tree = append(tree, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+
+	languages := make([]any, len(db.Languages))
+	for i, lang := range db.Languages {
+		languages[i] = lang
+	}
+	metadata, err := encode(nil, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 db.BuildEpoch,
+		"database_type":               db.Type,
+		"description":                 map[string]string{"en": "mmdbtest"},
+		"ip_version":                  uint16(6),
+		"languages":                   languages,
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.Write(tree)
+	b.Write(make([]byte, 16))
+	b.Write(data)
+	b.WriteString("\xab\xcd\xefMaxMind.com")
+	b.Write(metadata)
+	return b.Bytes(), nil
+}
+
+// The data types of the mmdb format.
+const (
+	typeString = 2
+	typeDouble = 3
+	typeUint16 = 5
+	typeUint32 = 6
+	typeMap    = 7
+	typeUint64 = 9
+	typeArray  = 11
+	typeBool   = 14
+)
+
+// control appends the control byte of a field of typ and size, followed by
+// its extended type and size bytes.
+func control(b []byte, typ, size int) []byte {
+	var first byte
+	var extended []byte
+	if typ <= 7 {
+		first = byte(typ << 5)
+	} else {
+		extended = []byte{byte(typ - 7)}
+	}
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		first |= byte(size)
+	case size < 285:
+		first |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		first |= 30
+		sizeBytes = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		first |= 31
+		n := size - 65821
+		sizeBytes = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	b = append(b, first)
+	b = append(b, extended...)
+	return append(b, sizeBytes...)
+}
+
+func encodeUint(b []byte, typ int, v uint64) []byte {
+	var be [8]byte
+	binary.BigEndian.PutUint64(be[:], v)
+	trimmed := bytes.TrimLeft(be[:], "\x00")
+	return append(control(b, typ, len(trimmed)), trimmed...)
+}
+
+func encode(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return append(control(b, typeString, len(v)), v...), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(control(b, typeDouble, 8), math.Float64bits(v)), nil
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		return control(b, typeBool, size), nil
+	case uint16:
+		return encodeUint(b, typeUint16, uint64(v)), nil
+	case uint32:
+		return encodeUint(b, typeUint32, uint64(v)), nil
+	case uint:
+		return encodeUint(b, typeUint32, uint64(v)), nil
+	case int:
+		if v < 0 {
+			return nil, fmt.Errorf("negative integer %d", v)
+		}
+		return encodeUint(b, typeUint32, uint64(v)), nil
+	case uint64:
+		return encodeUint(b, typeUint64, v), nil
+	case map[string]string:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = value
+		}
+		return encode(b, m)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b = control(b, typeMap, len(v))
+		for _, key := range keys {
+			var err error
+			if b, err = encode(b, key); err != nil {
+				return nil, err
+			}
+			if b, err = encode(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case []string:
+		a := make([]any, len(v))
+		for i, value := range v {
+			a[i] = value
+		}
+		return encode(b, a)
+	case []any:
+		b = control(b, typeArray, len(v))
+		for _, value := range v {
+			var err error
+			if b, err = encode(b, value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T in an mmdb", v)
+}
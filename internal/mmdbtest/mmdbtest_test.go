@@ -0,0 +1,65 @@
+package mmdbtest
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+func TestDatabase(t *testing.T) {
+	db := New("DBIP-Location-ISP (compat=Enterprise)", "en", "zh-CN")
+	db.Insert("1.0.0.0/16", map[string]any{
+		"country": map[string]any{"iso_code": "CN", "geoname_id": 1814991, "names": map[string]string{"en": "China", "zh-CN": "中国"}},
+	})
+	// splits 1.0.0.0/16
+	db.Insert("1.0.1.0/24", map[string]any{
+		"country":  map[string]any{"iso_code": "HK"},
+		"location": map[string]any{"latitude": 22.25, "longitude": 114.17},
+		"traits":   map[string]any{"is_anonymous": true, "autonomous_system_number": uint64(1 << 40)},
+	})
+	db.Insert("2400:da00::/32", map[string]any{"country": map[string]any{"iso_code": "CN"}})
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := db.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := reader.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if m := reader.Metadata(); m.DatabaseType != db.Type || m.BuildEpoch != DefaultBuildEpoch || len(m.Languages) != 2 {
+		t.Errorf("metadata = %+v", m)
+	}
+
+	tests := []struct {
+		addr    string
+		country string
+		network string
+	}{
+		{addr: "1.0.0.1", country: "CN", network: "1.0.0.0/24"},
+		{addr: "1.0.1.1", country: "HK", network: "1.0.1.0/24"},
+		{addr: "1.0.200.1", country: "CN", network: "1.0.128.0/17"},
+		{addr: "2400:da00::1", country: "CN", network: "2400:da00::/32"},
+		{addr: "1.1.0.0", network: "1.1.0.0/16"},
+		{addr: "2400:db00::1", network: "2400:db00::/24"},
+	}
+	for _, tt := range tests {
+		record, network, err := reader.LocationISPAddr(netip.MustParseAddr(tt.addr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Country.IsoCode != tt.country || network.String() != tt.network {
+			t.Errorf("%s: got %s %s, want %s %s", tt.addr, record.Country.IsoCode, network, tt.country, tt.network)
+		}
+	}
+	record, _, _ := reader.LocationISPAddr(netip.MustParseAddr("1.0.1.1"))
+	if !record.Traits.IsAnonymous || record.Traits.AutonomousSystemNumber != 1<<40 || record.Location.Latitude != 22.25 {
+		t.Errorf("record = %+v", record)
+	}
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// networkAttrs is what a reverse query can match in a record. The strings
+// are lowercased, and every one of them is kept in English and in zh-CN.
+type networkAttrs struct {
+	country   string
+	regions   []string
+	isps      []string
+	userTypes []string
+}
+
+func newNetworkAttrs(record *Record) networkAttrs {
+	attrs := networkAttrs{country: strings.ToUpper(record.Country.IsoCode)}
+	if len(record.Subdivisions) > 0 {
+		region := record.Subdivisions[0]
+		for _, name := range region.Names {
+			attrs.regions = append(attrs.regions, strings.ToLower(name))
+		}
+		if name, ok := placeName(region.GeoNameID, "zh-CN"); ok && region.Names["zh-CN"] == "" {
+			attrs.regions = append(attrs.regions, strings.ToLower(name))
+		}
+		sort.Strings(attrs.regions)
+	}
+	if record.Traits.ISP != "" {
+		for _, isp := range strings.Split(record.Traits.ISP, "/") {
+			attrs.isps = append(attrs.isps, strings.ToLower(isp), strings.ToLower(localizedISP(isp, "zh-CN")))
+		}
+	}
+	if record.Traits.UserType != "" {
+		attrs.userTypes = []string{
+			strings.ToLower(record.Traits.UserType),
+			strings.ToLower(localizedUserType(record.Traits.UserType, "zh-CN")),
+		}
+	}
+	return attrs
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkQuery selects networks by the fields of their record. Empty fields
+// match everything. Matches are exact but case-insensitive, in English or
+// in zh-CN; ISP matches any of the /-separated ISPs of a record.
+type NetworkQuery struct {
+	Country  string
+	Region   string
+	ISP      string
+	UserType string
+}
+
+func (q *NetworkQuery) match(attrs *networkAttrs) bool {
+	return (q.Country == "" || strings.EqualFold(q.Country, attrs.country)) &&
+		(q.Region == "" || containsString(attrs.regions, strings.ToLower(q.Region))) &&
+		(q.ISP == "" || containsString(attrs.isps, strings.ToLower(q.ISP))) &&
+		(q.UserType == "" || containsString(attrs.userTypes, strings.ToLower(q.UserType)))
+}
+
+// NetworkIndex answers reverse queries, from the fields of a record to the
+// networks that have it. It is built once from a database and never
+// changes, so it is safe for concurrent use.
+type NetworkIndex struct {
+	networks []netip.Prefix
+	// attrs[i] is the index in records of the attributes of networks[i].
+	attrs   []uint32
+	records []networkAttrs
+	// byCountry holds the indexes in networks of the ones of a country.
+	byCountry map[string][]int
+}
+
+// NewNetworkIndex walks every network of reader, which must be a location
+// database.
+func NewNetworkIndex(reader *geoip2.Reader) (*NetworkIndex, error) {
+	index := &NetworkIndex{byCountry: make(map[string][]int)}
+	seen := make(map[string]uint32)
+	networks := reader.LocationISPNetworks()
+	for networks.Next() {
+		prefix, record, err := networks.Network()
+		if err != nil {
+			return nil, err
+		}
+		attrs := newNetworkAttrs(record)
+		key := strings.Join([]string{
+			attrs.country,
+			strings.Join(attrs.regions, "|"),
+			strings.Join(attrs.isps, "|"),
+			strings.Join(attrs.userTypes, "|"),
+		}, "\x00")
+		id, ok := seen[key]
+		if !ok {
+			id = uint32(len(index.records))
+			seen[key] = id
+			index.records = append(index.records, attrs)
+		}
+		index.byCountry[attrs.country] = append(index.byCountry[attrs.country], len(index.networks))
+		index.networks = append(index.networks, prefix)
+		index.attrs = append(index.attrs, id)
+	}
+	if err := networks.Err(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Find returns the networks that match q, in address order, with adjacent
+// networks merged into the fewest prefixes that cover them.
+func (index *NetworkIndex) Find(q NetworkQuery) []netip.Prefix {
+	matches := make(map[uint32]bool)
+	match := func(i int) bool {
+		id := index.attrs[i]
+		matched, ok := matches[id]
+		if !ok {
+			matched = q.match(&index.records[id])
+			matches[id] = matched
+		}
+		return matched
+	}
+
+	var found []netip.Prefix
+	var start, end netip.Addr
+	flush := func() {
+		if start.IsValid() {
+			found = append(found, RangePrefixes(start, end)...)
+		}
+	}
+	add := func(prefix netip.Prefix) {
+		if start.IsValid() && end.Next() == prefix.Addr() {
+			end = LastAddr(prefix)
+			return
+		}
+		flush()
+		start, end = prefix.Addr(), LastAddr(prefix)
+	}
+
+	if q.Country != "" {
+		for _, i := range index.byCountry[strings.ToUpper(q.Country)] {
+			if match(i) {
+				add(index.networks[i])
+			}
+		}
+	} else {
+		for i, prefix := range index.networks {
+			if match(i) {
+				add(prefix)
+			}
+		}
+	}
+	flush()
+	return found
+}
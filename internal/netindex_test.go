@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yuryqwer/ip2loc/internal/mmdbtest"
+)
+
+func TestNetworkIndexFind(t *testing.T) {
+	db := mmdbtest.New(testLocationType, "en", "zh-CN")
+	cn := func(isp, userType string) map[string]any {
+		return testLocation("CN", "China", "中国", map[string]any{"isp": isp, "user_type": userType})
+	}
+	// adjacent across a /16 boundary, and aligned on one
+	db.Insert("1.0.255.0/24", cn("China Telecom", "residential"))
+	db.Insert("1.1.0.0/24", cn("China Telecom", "residential"))
+	db.Insert("1.2.0.0/16", cn("China Telecom", "residential"))
+	db.Insert("1.3.0.0/16", cn("China Telecom", "residential"))
+	// unaligned once merged
+	db.Insert("1.4.0.128/25", cn("China Unicom/China Telecom", "business"))
+	db.Insert("1.4.1.0/24", cn("China Unicom", "business"))
+	db.Insert("1.4.2.0/25", cn("China Unicom", "business"))
+	// the ends of the address spaces; the IPv6 networks start after ::/96,
+	// which holds the IPv4 ones
+	db.Insert("0.0.0.0/24", cn("China Mobile", "hosting"))
+	db.Insert("255.255.255.0/24", cn("China Mobile", "hosting"))
+	db.Insert("2400:da00::/32", cn("China Mobile", "hosting"))
+	db.Insert("ffff:ffff:ffff:ffff::/64", cn("China Mobile", "hosting"))
+	db.Insert("8.8.8.0/24", testLocation("US", "United States", "美国", map[string]any{"isp": "Google", "user_type": "hosting"}))
+	index, err := NewNetworkIndex(openDB(t, db))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query NetworkQuery
+		want  string
+	}{
+		{
+			name:  "across a /16 boundary",
+			query: NetworkQuery{ISP: "China Telecom", UserType: "residential"},
+			want:  "1.0.255.0/24,1.1.0.0/24,1.2.0.0/15",
+		},
+		{
+			name:  "unaligned",
+			query: NetworkQuery{UserType: "business"},
+			want:  "1.4.0.128/25,1.4.1.0/24,1.4.2.0/25",
+		},
+		{
+			name:  "one of the isps",
+			query: NetworkQuery{ISP: "china telecom", UserType: "Business"},
+			want:  "1.4.0.128/25",
+		},
+		{
+			name:  "in chinese",
+			query: NetworkQuery{ISP: "移动", Region: "广东"},
+			want:  "0.0.0.0/24,255.255.255.0/24,2400:da00::/32,ffff:ffff:ffff:ffff::/64",
+		},
+		{
+			name:  "country",
+			query: NetworkQuery{Country: "us"},
+			want:  "8.8.8.0/24",
+		},
+		{
+			name:  "country and user type",
+			query: NetworkQuery{Country: "CN", UserType: "hosting"},
+			want:  "0.0.0.0/24,255.255.255.0/24,2400:da00::/32,ffff:ffff:ffff:ffff::/64",
+		},
+		{
+			name:  "no match",
+			query: NetworkQuery{Country: "JP"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, prefix := range index.Find(tt.query) {
+				got = append(got, prefix.String())
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("Find(%+v) = %s, want %s", tt.query, strings.Join(got, ","), tt.want)
+			}
+		})
+	}
+}
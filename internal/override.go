@@ -0,0 +1,346 @@
+package internal
+
+import (
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// overrideSetters sets an IPInfo field, named as in its json tag, from the
+// text of an override.
+var overrideSetters = map[string]func(info *IPInfo, value string) error{
+	"continent":      func(info *IPInfo, v string) error { info.Continent = v; return nil },
+	"continent_code": func(info *IPInfo, v string) error { info.ContinentCode = v; return nil },
+	"country":        func(info *IPInfo, v string) error { info.Country = v; return nil },
+	"country_code":   func(info *IPInfo, v string) error { info.CountryCode = v; return nil },
+	"region":         func(info *IPInfo, v string) error { info.Region = v; return nil },
+	"region_code":    func(info *IPInfo, v string) error { info.RegionCode = v; return nil },
+	"city":           func(info *IPInfo, v string) error { info.City = v; return nil },
+	"zip":            func(info *IPInfo, v string) error { info.Postal = v; return nil },
+	"timezone":       func(info *IPInfo, v string) error { info.TimeZone = v; return nil },
+	"isp":            func(info *IPInfo, v string) error { info.ISP = v; return nil },
+	"user_type":      func(info *IPInfo, v string) error { info.UserType = v; return nil },
+	"as_organization": func(info *IPInfo, v string) error {
+		info.ASOrganization = v
+		return nil
+	},
+	"latitude": func(info *IPInfo, v string) (err error) {
+		info.Latitude, err = strconv.ParseFloat(v, 64)
+		return err
+	},
+	"longitude": func(info *IPInfo, v string) (err error) {
+		info.Longitude, err = strconv.ParseFloat(v, 64)
+		return err
+	},
+	"asn": func(info *IPInfo, v string) error {
+		asn, err := strconv.ParseUint(v, 10, 32)
+		info.ASN = uint(asn)
+		return err
+	},
+}
+
+// An Override forces some IPInfo fields for the addresses of a network.
+type Override struct {
+	Network netip.Prefix
+	// Lang limits the override to answers in that language; empty means
+	// every language.
+	Lang string
+	// Fields maps IPInfo fields, named as in their json tags, to the
+	// values that replace the ones from the database.
+	Fields map[string]string
+}
+
+// appliesTo reports whether the override applies to answers in lang.
+func (o Override) appliesTo(lang string) bool {
+	return o.Lang == "" || o.Lang == lang
+}
+
+// overrideIndex holds the overrides by network, for every prefix length
+// that has some, longest first. within holds, for every network that has
+// overrides in it, the languages they are for.
+type overrideIndex struct {
+	networks map[netip.Prefix][]Override
+	bits     []int
+	within   map[netip.Prefix]map[string]bool
+}
+
+func newOverrideIndex(overrides []Override) *overrideIndex {
+	index := &overrideIndex{
+		networks: make(map[netip.Prefix][]Override),
+		within:   make(map[netip.Prefix]map[string]bool),
+	}
+	seen := make(map[int]bool)
+	for _, o := range overrides {
+		index.networks[o.Network] = append(index.networks[o.Network], o)
+		if !seen[o.Network.Bits()] {
+			seen[o.Network.Bits()] = true
+			index.bits = append(index.bits, o.Network.Bits())
+		}
+		for network := o.Network; ; {
+			if index.within[network] == nil {
+				index.within[network] = make(map[string]bool)
+			}
+			index.within[network][o.Lang] = true
+			if network.Bits() == 0 {
+				break
+			}
+			network, _ = network.Addr().Prefix(network.Bits() - 1)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(index.bits)))
+	return index
+}
+
+// lookup returns the overrides for lang of the most specific network
+// containing addr that has some, or nil.
+func (index *overrideIndex) lookup(addr netip.Addr, lang string) []Override {
+	addr = addr.Unmap()
+	for _, bits := range index.bits {
+		if bits > addr.BitLen() {
+			continue
+		}
+		network, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		var applying []Override
+		for _, o := range index.networks[network] {
+			if o.appliesTo(lang) {
+				applying = append(applying, o)
+			}
+		}
+		if applying != nil {
+			return applying
+		}
+	}
+	return nil
+}
+
+// Overrides is a store of local corrections to the databases, loaded from
+// a CSV or JSON file and replaced as a whole by Reload.
+//
+// A CSV file has a header row naming its columns: network, the optional
+// lang, and any of the IPInfo fields as named in their json tags. A JSON
+// file is an array of objects with the same keys. Empty values are not
+// overridden.
+type Overrides struct {
+	Path  string
+	index atomic.Pointer[overrideIndex]
+}
+
+func NewOverrides(path string) (*Overrides, error) {
+	o := &Overrides{Path: path}
+	if err := o.Reload(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Reload reads the file again. The overrides in use are kept if it cannot
+// be read.
+func (o *Overrides) Reload() error {
+	rows, err := readRows(o.Path)
+	if err != nil {
+		return err
+	}
+	overrides, err := newOverrides(rows)
+	if err != nil {
+		return fmt.Errorf("%s: %w", o.Path, err)
+	}
+	o.index.Store(newOverrideIndex(overrides))
+	return nil
+}
+
+// narrow returns the largest network within network that holds addr and
+// gets a single answer once the overrides for lang are applied: no network
+// of such overrides cuts it, except for the one addr is in. It walks down
+// the halves of network that hold addr, so it costs one step per bit
+// whatever the number of overrides.
+func (index *overrideIndex) narrow(addr netip.Addr, lang string, network netip.Prefix) netip.Prefix {
+	addr = addr.Unmap()
+	network = network.Masked()
+	if network.Addr().Is4() != addr.Is4() {
+		return network
+	}
+	length := network.Bits()
+	for bits := network.Bits() + 1; bits <= addr.BitLen(); bits++ {
+		half, _ := addr.Prefix(bits)
+		if index.holds(sibling(half), lang) {
+			// the largest network of addr that stops short of the
+			// overrides in the other half
+			length = bits
+		}
+		if !index.holds(half, lang) {
+			break
+		}
+		for _, o := range index.networks[half] {
+			if o.appliesTo(lang) {
+				length = bits
+			}
+		}
+	}
+	narrowed, _ := addr.Prefix(length)
+	return narrowed
+}
+
+// holds reports whether network has overrides for lang in it.
+func (index *overrideIndex) holds(network netip.Prefix, lang string) bool {
+	langs := index.within[network]
+	return langs[""] || langs[lang]
+}
+
+// sibling returns the other half of the network p is a half of.
+func sibling(p netip.Prefix) netip.Prefix {
+	a16 := p.Addr().As16()
+	i := p.Bits() - 1 + 128 - p.Addr().BitLen()
+	a16[i/8] ^= 0x80 >> (i % 8)
+	addr := netip.AddrFrom16(a16)
+	if p.Addr().Is4() {
+		addr = addr.Unmap()
+	}
+	return netip.PrefixFrom(addr, p.Bits())
+}
+
+// commonBits returns the length of the longest prefix a and b, which are
+// of the same family, share.
+func commonBits(a, b netip.Addr) int {
+	a16, b16 := a.As16(), b.As16()
+	n := 0
+	for i := range a16 {
+		if x := a16[i] ^ b16[i]; x != 0 {
+			n += bits.LeadingZeros8(x)
+			break
+		}
+		n += 8
+	}
+	return n - (128 - a.BitLen())
+}
+
+// Apply returns info with the overrides for lang of the most specific
+// network that contains addr and has some merged over it and listed in
+// Overridden. Overrides for lang take precedence over the ones for every
+// language. The network of info is narrowed so that it does not span
+// addresses the overrides answer differently. info itself is left
+// untouched since it may be shared.
+func (o *Overrides) Apply(addr netip.Addr, lang string, info *IPInfo) *IPInfo {
+	index := o.index.Load()
+	if index == nil {
+		return info
+	}
+	network := info.Network.prefix()
+	narrowed := network
+	if network.IsValid() {
+		narrowed = index.narrow(addr, lang, network)
+	}
+	overrides := index.lookup(addr, lang)
+	if overrides == nil && narrowed == network {
+		return info
+	}
+	merged := *info
+	if narrowed != network {
+		merged.Network = newNetworkRange(narrowed)
+	}
+	overridden := make(map[string]bool)
+	apply := func(override Override) {
+		for field, value := range override.Fields {
+			// values were checked when loading
+			_ = overrideSetters[field](&merged, value)
+			merged.Languages.set(field, override.Lang)
+			overridden[field] = true
+		}
+	}
+	for _, override := range overrides {
+		if override.Lang == "" {
+			apply(override)
+		}
+	}
+	for _, override := range overrides {
+		if override.Lang != "" {
+			apply(override)
+		}
+	}
+	if len(overridden) == 0 {
+		if narrowed != network {
+			return &merged
+		}
+		return info
+	}
+	merged.Overridden = make([]string, 0, len(overridden))
+	for field := range overridden {
+		merged.Overridden = append(merged.Overridden, field)
+	}
+	sort.Strings(merged.Overridden)
+	return &merged
+}
+
+func newOverride(row map[string]string) (Override, error) {
+	override := Override{Fields: make(map[string]string)}
+	if row["lang"] != "" {
+		override.Lang = CanonicalLanguage(row["lang"])
+	}
+	network, err := netip.ParsePrefix(row["network"])
+	if err != nil {
+		if addr, addrErr := netip.ParseAddr(row["network"]); addrErr == nil {
+			network, err = addr.Prefix(addr.BitLen())
+		}
+	}
+	if err != nil {
+		return override, fmt.Errorf("invalid network %q", row["network"])
+	}
+	override.Network = network.Masked()
+	if override.Network.Addr().Is4In6() {
+		override.Network = netip.PrefixFrom(override.Network.Addr().Unmap(), override.Network.Bits()-96)
+	}
+	var check IPInfo
+	for field, value := range row {
+		if field == "network" || field == "lang" || value == "" {
+			continue
+		}
+		set, ok := overrideSetters[field]
+		if !ok {
+			return override, fmt.Errorf("%s: unknown field %q", network, field)
+		}
+		if err := set(&check, value); err != nil {
+			return override, fmt.Errorf("%s: invalid %s %q", network, field, value)
+		}
+		override.Fields[field] = value
+	}
+	return override, nil
+}
+
+// newOverrides returns the overrides of the entries of a file, as read by
+// readRows.
+func newOverrides(rows []map[string]string) ([]Override, error) {
+	overrides := make([]Override, 0, len(rows))
+	for i, row := range rows {
+		override, err := newOverride(row)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+// overrideLocator applies overrides to the answers of another Locator.
+type overrideLocator struct {
+	Locator
+	overrides *Overrides
+}
+
+// WithOverrides returns a Locator that answers like l with overrides merged
+// over its IPInfo. Records returned by Lookup are the databases' own.
+func WithOverrides(l Locator, overrides *Overrides) Locator {
+	return &overrideLocator{Locator: l, overrides: overrides}
+}
+
+func (l *overrideLocator) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	info, err := l.Locator.LookupIPInfo(addr, lang)
+	if err != nil {
+		return nil, err
+	}
+	return l.overrides.Apply(addr, lang, info), nil
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// readOverrides returns the overrides of the rows read from a file.
+func readOverrides(rows []map[string]string, err error) ([]Override, error) {
+	if err != nil {
+		return nil, err
+	}
+	return newOverrides(rows)
+}
+
+func TestReadCSVOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []Override
+		wantErr string
+	}{
+		{
+			name: "network and address",
+			csv:  "network,city,asn\n10.0.0.0/16,Somewhere,64512\n192.0.2.7,,\n",
+			want: []Override{
+				{Network: netip.MustParsePrefix("10.0.0.0/16"), Fields: map[string]string{"city": "Somewhere", "asn": "64512"}},
+				{Network: netip.MustParsePrefix("192.0.2.7/32"), Fields: map[string]string{}},
+			},
+		},
+		{
+			name: "masked and unmapped",
+			csv:  "network,city\n::ffff:10.1.2.3/120,Mapped\n",
+			want: []Override{
+				{Network: netip.MustParsePrefix("10.1.2.0/24"), Fields: map[string]string{"city": "Mapped"}},
+			},
+		},
+		{
+			name: "canonical languages",
+			csv:  "network,lang,city\n10.0.0.0/8,zh-cn,甲\n10.0.0.0/8,zh_CN,乙\n10.0.0.0/8,EN,C\n",
+			want: []Override{
+				{Network: netip.MustParsePrefix("10.0.0.0/8"), Lang: "zh-CN", Fields: map[string]string{"city": "甲"}},
+				{Network: netip.MustParsePrefix("10.0.0.0/8"), Lang: "zh-CN", Fields: map[string]string{"city": "乙"}},
+				{Network: netip.MustParsePrefix("10.0.0.0/8"), Lang: "en", Fields: map[string]string{"city": "C"}},
+			},
+		},
+		{
+			name: "comments and spaces",
+			csv:  "network, city\n# a comment\n10.0.0.0/8,  Spaced \n",
+			want: []Override{
+				{Network: netip.MustParsePrefix("10.0.0.0/8"), Fields: map[string]string{"city": "Spaced"}},
+			},
+		},
+		{name: "invalid network", csv: "network,city\n10.0.0.0/33,X\n", wantErr: `entry 1: invalid network "10.0.0.0/33"`},
+		{name: "unknown field", csv: "network,town\n10.0.0.0/8,X\n", wantErr: `unknown field "town"`},
+		{name: "invalid number", csv: "network,latitude\n10.0.0.0/8,north\n", wantErr: `invalid latitude "north"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readOverrides(readCSVRows(strings.NewReader(tt.csv)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d overrides, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].Network != tt.want[i].Network || got[i].Lang != tt.want[i].Lang {
+					t.Errorf("override %d is %s %q, want %s %q", i, got[i].Network, got[i].Lang, tt.want[i].Network, tt.want[i].Lang)
+				}
+				if len(got[i].Fields) != len(tt.want[i].Fields) {
+					t.Errorf("override %d fields = %v, want %v", i, got[i].Fields, tt.want[i].Fields)
+					continue
+				}
+				for field, value := range tt.want[i].Fields {
+					if got[i].Fields[field] != value {
+						t.Errorf("override %d %s = %q, want %q", i, field, got[i].Fields[field], value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReadJSONOverrides(t *testing.T) {
+	got, err := readOverrides(readJSONRows(strings.NewReader(`[{"network": "10.0.0.0/8", "lang": "en", "asn": 64512, "city": null}]`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Lang != "en" || got[0].Fields["asn"] != "64512" || len(got[0].Fields) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	if _, err := readOverrides(readJSONRows(strings.NewReader(`[{"network": "10.0.0.0/8", "city": true}]`))); err == nil {
+		t.Fatal("a boolean value was accepted")
+	}
+}
+
+func TestOverridesApply(t *testing.T) {
+	const csv = `network,lang,city,isp
+10.0.0.0/16,,AllLangCity,
+10.0.1.0/24,en,EnOnlyCity,
+10.0.2.0/24,,Neutral24,NeutralISP
+10.0.2.0/24,zh-CN,中文城市,
+2001:db8::/32,,V6City,
+`
+	overrides, err := readOverrides(readCSVRows(strings.NewReader(csv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &Overrides{}
+	o.index.Store(newOverrideIndex(overrides))
+
+	tests := []struct {
+		addr, lang  string
+		network     string
+		wantCity    string
+		wantISP     string
+		wantNetwork string
+		overridden  []string
+	}{
+		// the en-only /24 wins for en only
+		{addr: "10.0.1.5", lang: "en", network: "10.0.0.0/8", wantCity: "EnOnlyCity", wantISP: "DB ISP", wantNetwork: "10.0.1.0/24", overridden: []string{"city"}},
+		{addr: "10.0.1.5", lang: "zh-CN", network: "10.0.0.0/8", wantCity: "AllLangCity", wantISP: "DB ISP", wantNetwork: "10.0.0.0/23", overridden: []string{"city"}},
+		// an override for the language is applied over the neutral one
+		{addr: "10.0.2.9", lang: "zh-CN", network: "10.0.0.0/8", wantCity: "中文城市", wantISP: "NeutralISP", wantNetwork: "10.0.2.0/24", overridden: []string{"city", "isp"}},
+		{addr: "10.0.2.9", lang: "en", network: "10.0.0.0/8", wantCity: "Neutral24", wantISP: "NeutralISP", wantNetwork: "10.0.2.0/24", overridden: []string{"city", "isp"}},
+		// mapped addresses match IPv4 overrides
+		{addr: "::ffff:10.0.3.1", lang: "en", network: "10.0.0.0/8", wantCity: "AllLangCity", wantISP: "DB ISP", wantNetwork: "10.0.3.0/24", overridden: []string{"city"}},
+		{addr: "2001:db8::1", lang: "en", network: "2001:db8::/32", wantCity: "V6City", wantISP: "DB ISP", wantNetwork: "2001:db8::/32", overridden: []string{"city"}},
+		// the network is narrowed short of the overrides it spans
+		{addr: "10.1.0.1", lang: "en", network: "10.0.0.0/8", wantCity: "DB City", wantISP: "DB ISP", wantNetwork: "10.1.0.0/16"},
+		{addr: "192.0.2.1", lang: "en", network: "192.0.2.0/24", wantCity: "DB City", wantISP: "DB ISP", wantNetwork: "192.0.2.0/24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr+" "+tt.lang, func(t *testing.T) {
+			info := &IPInfo{City: "DB City", ISP: "DB ISP", Network: newNetworkRange(netip.MustParsePrefix(tt.network))}
+			got := o.Apply(netip.MustParseAddr(tt.addr), tt.lang, info)
+			if got.City != tt.wantCity || got.ISP != tt.wantISP {
+				t.Errorf("city, isp = %q, %q, want %q, %q", got.City, got.ISP, tt.wantCity, tt.wantISP)
+			}
+			if got.Network == nil || got.Network.CIDR != tt.wantNetwork {
+				t.Errorf("network = %+v, want %s", got.Network, tt.wantNetwork)
+			}
+			if strings.Join(got.Overridden, ",") != strings.Join(tt.overridden, ",") {
+				t.Errorf("overridden = %v, want %v", got.Overridden, tt.overridden)
+			}
+			if info.City != "DB City" || info.Overridden != nil {
+				t.Errorf("the database info was modified: %+v", info)
+			}
+		})
+	}
+}
+
+func TestOverridesNarrow(t *testing.T) {
+	overrides, err := readOverrides(readCSVRows(strings.NewReader(`network,lang,city
+10.0.0.0/16,,A
+10.0.0.128/25,,B
+10.0.4.0/24,ja,C
+10.255.255.255,,D
+2001:db8:ffff::/48,,E
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := newOverrideIndex(overrides)
+	tests := []struct {
+		addr, lang string
+		network    string
+		want       string
+	}{
+		// the nested /25 cuts the /16 addr is in
+		{addr: "10.0.0.1", lang: "en", network: "10.0.0.0/8", want: "10.0.0.0/25"},
+		{addr: "10.0.0.200", lang: "en", network: "10.0.0.0/8", want: "10.0.0.128/25"},
+		{addr: "10.0.4.1", lang: "en", network: "10.0.0.0/8", want: "10.0.4.0/22"},
+		{addr: "10.0.4.1", lang: "ja", network: "10.0.0.0/8", want: "10.0.4.0/24"},
+		{addr: "10.0.5.1", lang: "ja", network: "10.0.0.0/8", want: "10.0.5.0/24"},
+		{addr: "10.1.0.1", lang: "en", network: "10.0.0.0/8", want: "10.1.0.0/16"},
+		{addr: "10.255.255.254", lang: "en", network: "10.0.0.0/8", want: "10.255.255.254/32"},
+		{addr: "10.255.255.255", lang: "en", network: "10.0.0.0/8", want: "10.255.255.255/32"},
+		// the network is already within an override, or outside of them
+		{addr: "10.0.0.130", lang: "en", network: "10.0.0.128/26", want: "10.0.0.128/26"},
+		{addr: "192.0.2.1", lang: "en", network: "192.0.0.0/16", want: "192.0.0.0/16"},
+		{addr: "2001:db8::1", lang: "en", network: "2001:db8::/32", want: "2001:db8::/33"},
+		{addr: "2001:db8:ffff::1", lang: "en", network: "2001:db8::/32", want: "2001:db8:ffff::/48"},
+		{addr: "::ffff:10.1.0.1", lang: "en", network: "10.0.0.0/8", want: "10.1.0.0/16"},
+	}
+	for _, tt := range tests {
+		got := index.narrow(netip.MustParseAddr(tt.addr), tt.lang, netip.MustParsePrefix(tt.network))
+		if got.String() != tt.want {
+			t.Errorf("narrow(%s, %s, %s) = %s, want %s", tt.addr, tt.lang, tt.network, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+type placeKey struct {
+	geoNameID uint
+	lang      string
+}
+
+// placeDictionary holds the names of places by geoname ID and language.
+type placeDictionary struct {
+	names map[placeKey]string
+}
+
+// placeNames is the dictionary in use, nil until a PlaceNames file is
+// loaded.
+var placeNames atomic.Pointer[placeDictionary]
+
+// placeName returns the name of the place geoNameID in lang from the place
+// names, if they have one.
+func placeName(geoNameID uint, lang string) (string, bool) {
+	d := placeNames.Load()
+	if d == nil || geoNameID == 0 {
+		return "", false
+	}
+	name, ok := d.names[placeKey{geoNameID: geoNameID, lang: lang}]
+	return name, ok
+}
+
+// PlaceNames is a file of names of continents, countries, regions and
+// cities by geoname ID, for the languages the databases lack them in. A
+// name of the file is used in a language before the fallback languages
+// are tried, but the database's own name comes first. Reload replaces the
+// names as a whole.
+//
+// A CSV file has a header row naming its columns: geoname_id; lang, empty
+// for zh-CN; and name. Rows without a name are skipped, so that the output
+// of the untranslated report can be filled in as it goes. A JSON file is an
+// array of objects with the same keys.
+type PlaceNames struct {
+	Path string
+}
+
+func NewPlaceNames(path string) (*PlaceNames, error) {
+	n := &PlaceNames{Path: path}
+	if err := n.Reload(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Reload reads the file again. The names in use are kept if it cannot be
+// read.
+func (n *PlaceNames) Reload() error {
+	rows, err := readRows(n.Path)
+	if err != nil {
+		return err
+	}
+	d := &placeDictionary{names: make(map[placeKey]string, len(rows))}
+	for i, row := range rows {
+		if row["name"] == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(row["geoname_id"], 10, 0)
+		if err != nil || id == 0 {
+			return fmt.Errorf("%s: entry %d: invalid geoname_id %q", n.Path, i+1, row["geoname_id"])
+		}
+		d.names[placeKey{geoNameID: uint(id), lang: CanonicalLanguage(row["lang"])}] = row["name"]
+	}
+	placeNames.Store(d)
+	return nil
+}
+
+// UntranslatedPlace is a place that was answered in another language than
+// the one asked for, because neither the database nor the place names have
+// its name in that language.
+type UntranslatedPlace struct {
+	GeoNameID uint   `json:"geoname_id"`
+	Lang      string `json:"lang"`
+	// Field is the field of the answers the place was in: continent,
+	// country, region or city.
+	Field string `json:"field"`
+	// Name is the name answered instead, in NameLang.
+	Name     string `json:"name"`
+	NameLang string `json:"name_lang"`
+	Queries  uint64 `json:"queries"`
+}
+
+// maxUntranslated bounds the places counted, so that a database with many
+// untranslated places cannot grow the counts without limit. Places seen
+// once the limit is reached are not counted.
+const maxUntranslated = 100000
+
+var untranslated = struct {
+	mu     sync.Mutex
+	places map[placeKey]*UntranslatedPlace
+}{places: make(map[placeKey]*UntranslatedPlace)}
+
+// countUntranslated counts a query answered with the untranslated places
+// of info.
+func countUntranslated(info *IPInfo) {
+	if len(info.untranslated) == 0 {
+		return
+	}
+	untranslated.mu.Lock()
+	defer untranslated.mu.Unlock()
+	for _, place := range info.untranslated {
+		key := placeKey{geoNameID: place.GeoNameID, lang: place.Lang}
+		counted, ok := untranslated.places[key]
+		if !ok {
+			if len(untranslated.places) >= maxUntranslated {
+				continue
+			}
+			counted = new(UntranslatedPlace)
+			*counted = place
+			untranslated.places[key] = counted
+		}
+		counted.Queries++
+	}
+}
+
+// UntranslatedPlaces returns the n most queried places that have no name in
+// lang, or in any language when lang is empty, most queried first. Queries
+// are counted since the start, but places the place names now translate
+// are left out.
+func UntranslatedPlaces(lang string, n int) []UntranslatedPlace {
+	if lang != "" {
+		lang = CanonicalLanguage(lang)
+	}
+	untranslated.mu.Lock()
+	places := make([]UntranslatedPlace, 0, len(untranslated.places))
+	for _, place := range untranslated.places {
+		if lang == "" || place.Lang == lang {
+			places = append(places, *place)
+		}
+	}
+	untranslated.mu.Unlock()
+
+	kept := 0
+	for _, place := range places {
+		if _, ok := placeName(place.GeoNameID, place.Lang); !ok {
+			places[kept] = place
+			kept++
+		}
+	}
+	places = places[:kept]
+	sort.Slice(places, func(i, j int) bool {
+		if places[i].Queries != places[j].Queries {
+			return places[i].Queries > places[j].Queries
+		}
+		if places[i].GeoNameID != places[j].GeoNameID {
+			return places[i].GeoNameID < places[j].GeoNameID
+		}
+		return places[i].Lang < places[j].Lang
+	})
+	if n < len(places) {
+		places = places[:n]
+	}
+	return places
+}
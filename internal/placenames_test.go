@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// keepPlaceNames restores the place names in use once the test is done.
+func keepPlaceNames(t *testing.T) {
+	t.Helper()
+	saved := placeNames.Load()
+	t.Cleanup(func() { placeNames.Store(saved) })
+}
+
+// keepUntranslated counts the untranslated places of the test apart from
+// the others.
+func keepUntranslated(t *testing.T) {
+	t.Helper()
+	untranslated.mu.Lock()
+	saved := untranslated.places
+	untranslated.places = make(map[placeKey]*UntranslatedPlace)
+	untranslated.mu.Unlock()
+	t.Cleanup(func() {
+		untranslated.mu.Lock()
+		untranslated.places = saved
+		untranslated.mu.Unlock()
+	})
+}
+
+func writePlaceNames(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "places.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPlaceNamesReload(t *testing.T) {
+	keepPlaceNames(t)
+	placeNames.Store(nil)
+	if _, err := NewPlaceNames(writePlaceNames(t, "geoname_id,lang,name\nShenzhen,,深圳\n")); err == nil {
+		t.Fatal("an invalid geoname_id was loaded")
+	}
+	if name, ok := placeName(1795565, "zh-CN"); ok {
+		t.Errorf("placeName = %q after a failed load", name)
+	}
+
+	path := writePlaceNames(t, "geoname_id,lang,name\n1795565,,深圳\n1795565,zh_tw,深圳市\n1809858,,\n")
+	names, err := NewPlaceNames(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		geoNameID uint
+		lang      string
+		want      string
+	}{
+		{geoNameID: 1795565, lang: "zh-CN", want: "深圳"},
+		{geoNameID: 1795565, lang: "zh-TW", want: "深圳市"},
+		{geoNameID: 1795565, lang: "en"},
+		// rows without a name are skipped
+		{geoNameID: 1809858, lang: "zh-CN"},
+		{geoNameID: 0, lang: "zh-CN"},
+	}
+	for _, tt := range tests {
+		if name, ok := placeName(tt.geoNameID, tt.lang); name != tt.want || ok != (tt.want != "") {
+			t.Errorf("placeName(%d, %s) = %q, %v, want %q", tt.geoNameID, tt.lang, name, ok, tt.want)
+		}
+	}
+
+	// a failed reload keeps the names last loaded
+	if err := os.WriteFile(path, []byte("geoname_id,name\n0,零\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := names.Reload(); err == nil || !strings.Contains(err.Error(), "entry 1") {
+		t.Errorf("Reload() = %v, want an error for entry 1", err)
+	}
+	if name, _ := placeName(1795565, "zh-CN"); name != "深圳" {
+		t.Errorf("placeName = %q after a failed reload", name)
+	}
+}
+
+func TestLocalizedNamePlaceNames(t *testing.T) {
+	keepPlaceNames(t)
+	placeNames.Store(&placeDictionary{names: map[placeKey]string{
+		{geoNameID: 1, lang: "zh-CN"}: "甲（文件）",
+		{geoNameID: 1, lang: "de"}:    "A (Datei)",
+		{geoNameID: 2, lang: "fr"}:    "B (fichier)",
+	}})
+	tests := []struct {
+		name      string
+		geoNameID uint
+		names     map[string]string
+		chain     []string
+		want      string
+		lang      string
+	}{
+		// the database's own name comes first
+		{name: "database", geoNameID: 1, names: map[string]string{"zh-CN": "甲", "en": "A"}, chain: []string{"zh-CN", "en"}, want: "甲", lang: "zh-CN"},
+		// then the place names, before the fallbacks
+		{name: "place names", geoNameID: 1, names: map[string]string{"en": "A"}, chain: []string{"zh-CN", "en"}, want: "甲（文件）", lang: "zh-CN"},
+		{name: "place names in the chain", geoNameID: 1, names: map[string]string{"en": "A"}, chain: []string{"ja", "de", "en"}, want: "A (Datei)", lang: "de"},
+		{name: "fallback", geoNameID: 2, names: map[string]string{"en": "B"}, chain: []string{"zh-CN", "en"}, want: "B", lang: "en"},
+		{name: "no geoname id", names: map[string]string{"en": "C"}, chain: []string{"zh-CN", "en"}, want: "C", lang: "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, lang := localizedName(tt.geoNameID, tt.names, tt.chain)
+			if got != tt.want || lang != tt.lang {
+				t.Errorf("localizedName = %q, %q, want %q, %q", got, lang, tt.want, tt.lang)
+			}
+		})
+	}
+}
+
+func TestUntranslatedPlaces(t *testing.T) {
+	keepPlaceNames(t)
+	keepUntranslated(t)
+	placeNames.Store(&placeDictionary{names: map[placeKey]string{{geoNameID: 3, lang: "zh-CN"}: "丙"}})
+	place := func(geoNameID uint, lang string) UntranslatedPlace {
+		return UntranslatedPlace{GeoNameID: geoNameID, Lang: lang, Field: "city", Name: "X", NameLang: "en"}
+	}
+	for _, places := range [][]UntranslatedPlace{
+		{place(1, "zh-CN"), place(2, "zh-CN")},
+		{place(2, "zh-CN"), place(1, "de")},
+		{place(2, "zh-CN"), place(3, "zh-CN")},
+	} {
+		countUntranslated(&IPInfo{untranslated: places})
+	}
+
+	tests := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		// 3 is translated by the place names since it was counted
+		{lang: "zh-cn", n: 10, want: "2/zh-CN:3,1/zh-CN:1"},
+		{lang: "zh-CN", n: 1, want: "2/zh-CN:3"},
+		{lang: "", n: 10, want: "2/zh-CN:3,1/de:1,1/zh-CN:1"},
+		{lang: "fr", n: 10},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, p := range UntranslatedPlaces(tt.lang, tt.n) {
+			got = append(got, fmt.Sprintf("%d/%s:%d", p.GeoNameID, p.Lang, p.Queries))
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("UntranslatedPlaces(%q, %d) = %s, want %s", tt.lang, tt.n, strings.Join(got, ","), tt.want)
+		}
+	}
+}
+
+func TestCountUntranslatedSaturation(t *testing.T) {
+	keepUntranslated(t)
+	untranslated.mu.Lock()
+	for i := 1; i <= maxUntranslated; i++ {
+		untranslated.places[placeKey{geoNameID: uint(i), lang: "zh-CN"}] = &UntranslatedPlace{GeoNameID: uint(i), Lang: "zh-CN"}
+	}
+	untranslated.mu.Unlock()
+
+	countUntranslated(&IPInfo{untranslated: []UntranslatedPlace{
+		{GeoNameID: 1, Lang: "zh-CN"},
+		{GeoNameID: 1, Lang: "de"},
+		{GeoNameID: maxUntranslated + 1, Lang: "zh-CN"},
+	}})
+	untranslated.mu.Lock()
+	defer untranslated.mu.Unlock()
+	if n := len(untranslated.places); n != maxUntranslated {
+		t.Errorf("%d places counted, want %d", n, maxUntranslated)
+	}
+	// the places already counted still are
+	if queries := untranslated.places[placeKey{geoNameID: 1, lang: "zh-CN"}].Queries; queries != 1 {
+		t.Errorf("place 1 has %d queries, want 1", queries)
+	}
+}
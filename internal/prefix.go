@@ -0,0 +1,57 @@
+package internal
+
+import "net/netip"
+
+// LastAddr returns the last address of prefix.
+func LastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().As16()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	for i := 15; i >= 0 && hostBits > 0; i-- {
+		n := 8
+		if hostBits < n {
+			n = hostBits
+		}
+		addr[i] |= byte(1<<n - 1)
+		hostBits -= n
+	}
+	if prefix.Addr().Is4() {
+		return netip.AddrFrom16(addr).Unmap()
+	}
+	return netip.AddrFrom16(addr)
+}
+
+// RangePrefixes returns the fewest prefixes that cover start to end, which
+// must be of the same family.
+func RangePrefixes(start, end netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		// the largest prefix starting at start that does not go past end
+		bits := start.BitLen()
+		for bits > 0 {
+			prefix := netip.PrefixFrom(start, bits-1).Masked()
+			if prefix.Addr() != start || end.Less(LastAddr(prefix)) {
+				break
+			}
+			bits--
+		}
+		prefix := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, prefix)
+		last := LastAddr(prefix)
+		if last == end {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
+
+// rangePrefix returns the largest prefix that holds addr without going
+// past start or end, which must hold addr between them.
+func rangePrefix(start, end, addr netip.Addr) netip.Prefix {
+	for bits := 0; bits < addr.BitLen(); bits++ {
+		prefix, _ := addr.Prefix(bits)
+		if !prefix.Addr().Less(start) && !end.Less(LastAddr(prefix)) {
+			return prefix
+		}
+	}
+	return netip.PrefixFrom(addr, addr.BitLen())
+}
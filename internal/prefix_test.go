@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestLastAddr(t *testing.T) {
+	tests := map[string]string{
+		"1.0.0.0/24":         "1.0.0.255",
+		"1.0.0.0/23":         "1.0.1.255",
+		"1.0.0.7/32":         "1.0.0.7",
+		"0.0.0.0/0":          "255.255.255.255",
+		"255.255.255.255/32": "255.255.255.255",
+		"2001:db8::/32":      "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff",
+		"2001:db8::/61":      "2001:db8:0:7:ffff:ffff:ffff:ffff",
+		"::/0":               "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+		"::/128":             "::",
+	}
+	for prefix, want := range tests {
+		if got := LastAddr(netip.MustParsePrefix(prefix)); got.String() != want {
+			t.Errorf("LastAddr(%s) = %s, want %s", prefix, got, want)
+		}
+	}
+}
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       string
+	}{
+		{start: "1.0.0.0", end: "1.0.0.255", want: "1.0.0.0/24"},
+		{start: "1.0.0.0", end: "1.0.1.255", want: "1.0.0.0/23"},
+		// unaligned
+		{start: "1.0.0.1", end: "1.0.0.6", want: "1.0.0.1/32,1.0.0.2/31,1.0.0.4/31,1.0.0.6/32"},
+		{start: "1.0.0.128", end: "1.0.2.127", want: "1.0.0.128/25,1.0.1.0/24,1.0.2.0/25"},
+		// across a /16 boundary, which only merges when aligned
+		{start: "1.0.255.0", end: "1.1.0.255", want: "1.0.255.0/24,1.1.0.0/24"},
+		{start: "1.0.0.0", end: "1.1.255.255", want: "1.0.0.0/15"},
+		{start: "1.1.0.0", end: "1.2.255.255", want: "1.1.0.0/16,1.2.0.0/16"},
+		// the edges of the address space
+		{start: "0.0.0.0", end: "255.255.255.255", want: "0.0.0.0/0"},
+		{start: "255.255.255.255", end: "255.255.255.255", want: "255.255.255.255/32"},
+		{start: "255.255.255.254", end: "255.255.255.255", want: "255.255.255.254/31"},
+		{start: "0.0.0.0", end: "0.0.0.0", want: "0.0.0.0/32"},
+		{start: "::", end: "::", want: "::/128"},
+		{start: "::", end: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", want: "::/0"},
+		{start: "::1", end: "::3", want: "::1/128,::2/127"},
+		{start: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", end: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", want: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"},
+		{start: "2001:db8::", end: "2001:db8:1:ffff:ffff:ffff:ffff:ffff", want: "2001:db8::/47"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, prefix := range RangePrefixes(netip.MustParseAddr(tt.start), netip.MustParseAddr(tt.end)) {
+			got = append(got, prefix.String())
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("RangePrefixes(%s, %s) = %s, want %s", tt.start, tt.end, strings.Join(got, ","), tt.want)
+		}
+	}
+}
+
+func TestRangePrefix(t *testing.T) {
+	tests := []struct {
+		start, end, addr string
+		want             string
+	}{
+		{start: "1.0.0.0", end: "1.0.0.255", addr: "1.0.0.7", want: "1.0.0.0/24"},
+		{start: "1.0.0.1", end: "1.0.0.255", addr: "1.0.0.200", want: "1.0.0.128/25"},
+		{start: "1.0.0.1", end: "1.0.0.255", addr: "1.0.0.1", want: "1.0.0.1/32"},
+		{start: "1.0.0.1", end: "1.0.0.255", addr: "1.0.0.2", want: "1.0.0.2/31"},
+		{start: "1.0.255.0", end: "1.1.0.255", addr: "1.1.0.9", want: "1.1.0.0/24"},
+		{start: "0.0.0.0", end: "255.255.255.255", addr: "8.8.8.8", want: "0.0.0.0/0"},
+		{start: "255.255.255.255", end: "255.255.255.255", addr: "255.255.255.255", want: "255.255.255.255/32"},
+		{start: "::", end: "::", addr: "::", want: "::/128"},
+		{start: "::", end: "::ff", addr: "::1", want: "::/120"},
+		{start: "2001:db8::", end: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", addr: "2001:db8::1", want: "2001:db8::/29"},
+	}
+	for _, tt := range tests {
+		got := rangePrefix(netip.MustParseAddr(tt.start), netip.MustParseAddr(tt.end), netip.MustParseAddr(tt.addr))
+		if got.String() != tt.want {
+			t.Errorf("rangePrefix(%s, %s, %s) = %s, want %s", tt.start, tt.end, tt.addr, got, tt.want)
+		}
+	}
+}
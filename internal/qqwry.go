@@ -0,0 +1,401 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// The layout of a qqwry.dat file: a header with the offsets of the first
+// and last index entries, the records, then the index. Every index entry
+// is the first address of a range and the 3-byte offset of its record,
+// which holds the last address of the range then the country and area
+// strings, or redirects to them.
+const (
+	qqwryIndexSize     = 7
+	qqwryRedirectMode1 = 0x01
+	qqwryRedirectMode2 = 0x02
+)
+
+// qqwryFile is a qqwry.dat loaded in memory.
+type qqwryFile struct {
+	content     []byte
+	first, last uint32
+	// built is the date of the release, zero when unknown.
+	built time.Time
+}
+
+func newQQWryFile(content []byte) (*qqwryFile, error) {
+	if len(content) < 8 {
+		return nil, errors.New("truncated qqwry file")
+	}
+	q := &qqwryFile{
+		content: content,
+		first:   binary.LittleEndian.Uint32(content),
+		last:    binary.LittleEndian.Uint32(content[4:]),
+	}
+	if q.first < 8 || q.last < q.first || int(q.last)+qqwryIndexSize > len(content) ||
+		(q.last-q.first)%qqwryIndexSize != 0 {
+		return nil, fmt.Errorf("invalid qqwry index %d-%d in a file of %d bytes", q.first, q.last, len(content))
+	}
+	// the record of the last range is the one written last before the index
+	if offset := q.uint24(q.last + 4); int(offset)+4 > len(content) {
+		return nil, fmt.Errorf("qqwry record at %d out of range", offset)
+	}
+	return q, nil
+}
+
+func (q *qqwryFile) uint24(offset uint32) uint32 {
+	if int(offset)+3 > len(q.content) {
+		return 0
+	}
+	b := q.content[offset:]
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// cstring returns the zero terminated string at offset and the offset
+// right after it.
+func (q *qqwryFile) cstring(offset uint32) ([]byte, uint32) {
+	if int(offset) >= len(q.content) {
+		return nil, offset
+	}
+	s := q.content[offset:]
+	if end := bytes.IndexByte(s, 0); end >= 0 {
+		return s[:end], offset + uint32(end) + 1
+	}
+	return s, uint32(len(q.content))
+}
+
+// area reads the area string at offset, following its redirect if any.
+func (q *qqwryFile) area(offset uint32) []byte {
+	if int(offset) >= len(q.content) {
+		return nil
+	}
+	switch q.content[offset] {
+	case qqwryRedirectMode1, qqwryRedirectMode2:
+		target := q.uint24(offset + 1)
+		if target == 0 {
+			return nil
+		}
+		s, _ := q.cstring(target)
+		return s
+	}
+	s, _ := q.cstring(offset)
+	return s
+}
+
+// search returns the country and area strings of ip, undecoded, with the
+// first and last addresses of its range, and false when it is in no range.
+func (q *qqwryFile) search(ip uint32) (country, area []byte, start, end uint32, ok bool) {
+	count := int((q.last-q.first)/qqwryIndexSize) + 1
+	// the first range starting after ip
+	i := sort.Search(count, func(i int) bool {
+		return binary.LittleEndian.Uint32(q.content[q.first+uint32(i)*qqwryIndexSize:]) > ip
+	})
+	if i == 0 {
+		return nil, nil, 0, 0, false
+	}
+	entry := q.first + uint32(i-1)*qqwryIndexSize
+	record := q.uint24(entry + 4)
+	if int(record)+4 > len(q.content) || binary.LittleEndian.Uint32(q.content[record:]) < ip {
+		return nil, nil, 0, 0, false
+	}
+	start, end = binary.LittleEndian.Uint32(q.content[entry:]), binary.LittleEndian.Uint32(q.content[record:])
+
+	offset := record + 4
+	if int(offset) >= len(q.content) {
+		return nil, nil, 0, 0, false
+	}
+	switch q.content[offset] {
+	case qqwryRedirectMode1:
+		offset = q.uint24(offset + 1)
+		if int(offset) < len(q.content) && q.content[offset] == qqwryRedirectMode2 {
+			country, _ = q.cstring(q.uint24(offset + 1))
+			area = q.area(offset + 4)
+		} else {
+			var next uint32
+			country, next = q.cstring(offset)
+			area = q.area(next)
+		}
+	case qqwryRedirectMode2:
+		country, _ = q.cstring(q.uint24(offset + 1))
+		area = q.area(offset + 4)
+	default:
+		var next uint32
+		country, next = q.cstring(offset)
+		area = q.area(next)
+	}
+	return country, area, start, end, true
+}
+
+var qqwryDate = regexp.MustCompile(`(\d{4})年(\d{1,2})月(\d{1,2})日`)
+
+// releaseDate returns the date of the release, which is written in the
+// area string of the last range, such as 2024年01月10日IP数据.
+func (q *qqwryFile) releaseDate() (time.Time, bool) {
+	_, area, _, _, ok := q.search(binary.LittleEndian.Uint32(q.content[q.last:]))
+	if !ok {
+		return time.Time{}, false
+	}
+	m := qqwryDate.FindStringSubmatch(decodeGBK(area))
+	if m == nil {
+		return time.Time{}, false
+	}
+	date, err := time.Parse("2006-1-2", m[1]+"-"+m[2]+"-"+m[3])
+	return date, err == nil
+}
+
+// QQWry is the Locator backed by a qqwry.dat (纯真 IP 库) file, loaded in
+// memory. Its country string, such as 广东省深圳市 or 美国, is split into
+// the country, the province and the city, and the ISP is recognized in its
+// area string with the ISP names. Only IPv4 is covered.
+type QQWry struct {
+	Path string
+	// Golden, when set, holds assertions the file must pass to be loaded.
+	Golden *Golden
+	file   atomic.Pointer[qqwryFile]
+}
+
+func NewQQWry(path string, golden *Golden) (*QQWry, error) {
+	db := &QQWry{Path: path, Golden: golden}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// IsQQWry reports whether path names a qqwry.dat file: its extension is
+// .dat and its header points to an index of whole entries that ends the
+// file, which the .dat files of other formats do not have.
+func IsQQWry(path string) bool {
+	if !strings.HasSuffix(strings.ToLower(path), ".dat") {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var header [8]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	first, last := binary.LittleEndian.Uint32(header[:]), binary.LittleEndian.Uint32(header[4:])
+	return first >= 8 && last >= first && (last-first)%qqwryIndexSize == 0 &&
+		int64(last)+qqwryIndexSize == info.Size()
+}
+
+// Reload reads the file again. The file in use is kept if the new one
+// cannot be read or fails verification.
+func (db *QQWry) Reload() error {
+	content, err := os.ReadFile(db.Path)
+	if err != nil {
+		return err
+	}
+	q, err := newQQWryFile(content)
+	if err != nil {
+		return fmt.Errorf("%s failed verification: %w", db.Path, err)
+	}
+	if date, ok := q.releaseDate(); ok {
+		q.built = date
+	} else if info, err := os.Stat(db.Path); err == nil {
+		q.built = info.ModTime()
+	}
+	if db.Golden != nil {
+		candidate := &QQWry{Path: db.Path}
+		candidate.file.Store(q)
+		if err := db.Golden.Check(candidate); err != nil {
+			return fmt.Errorf("%s failed verification: %w", db.Path, err)
+		}
+	}
+	db.file.Store(q)
+	return nil
+}
+
+// Lookup returns the record of addr. IPv6 addresses, and IPv4 ones in no
+// range, get an empty record.
+func (db *QQWry) Lookup(addr netip.Addr) (*Record, error) {
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("%s is not a valid ip address", addr)
+	}
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return &Record{}, nil
+	}
+	a4 := addr.As4()
+	country, area, start, end, ok := db.file.Load().search(binary.BigEndian.Uint32(a4[:]))
+	if !ok {
+		return &Record{}, nil
+	}
+	record := qqwryRecord(decodeGBK(country), decodeGBK(area))
+	record.Traits.Network = rangePrefix(netip.AddrFrom4(uint32Bytes(start)), netip.AddrFrom4(uint32Bytes(end)), addr).String()
+	return record, nil
+}
+
+func (db *QQWry) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	record, err := db.Lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	return GetIPInfoFromLocationISP(record, lang), nil
+}
+
+// Databases describes the file, dated as in its last range or, lacking
+// that, when it was written.
+func (db *QQWry) Databases() []DatabaseInfo {
+	return []DatabaseInfo{{
+		Role:         RoleLocation,
+		Path:         db.Path,
+		DatabaseType: "qqwry",
+		BuildEpoch:   uint(db.file.Load().built.Unix()),
+		Languages:    []string{"zh-CN"},
+		IPVersion:    4,
+	}}
+}
+
+func (db *QQWry) Close() error {
+	return nil
+}
+
+func decodeGBK(s []byte) string {
+	decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(s)
+	if err != nil {
+		return string(s)
+	}
+	return string(decoded)
+}
+
+// The provinces of China as qqwry names them, without their suffix.
+var qqwryProvinces = []string{
+	"北京", "天津", "上海", "重庆", "河北", "山西", "辽宁", "吉林", "黑龙江",
+	"江苏", "浙江", "安徽", "福建", "江西", "山东", "河南", "湖北", "湖南",
+	"广东", "海南", "四川", "贵州", "云南", "陕西", "甘肃", "青海",
+	"内蒙古", "广西", "西藏", "宁夏", "新疆",
+}
+
+// The regions qqwry names like provinces, which have their own iso codes.
+var qqwryRegions = []struct{ name, code string }{
+	{"台湾", "TW"}, {"香港", "HK"}, {"澳门", "MO"},
+}
+
+var qqwryProvinceSuffixes = []string{
+	"维吾尔自治区", "壮族自治区", "回族自治区", "自治区", "特别行政区", "省", "市",
+}
+
+// The suffixes that end the name of a city, longest first.
+var qqwryCitySuffixes = []string{"自治州", "地区", "市", "州", "盟"}
+
+// qqwryRecord maps the strings of a range to a record the way the dbip's
+// mmdb has it: the province is the first subdivision and the city the
+// second.
+func qqwryRecord(country, area string) *Record {
+	var record Record
+	country = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(country), "CZ88.NET"))
+	area = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(area), "CZ88.NET"))
+
+	var code, province, city string
+	for _, region := range qqwryRegions {
+		if !strings.HasPrefix(country, region.name) {
+			continue
+		}
+		// 台湾省台北市: the rest is the city
+		code, city = region.code, country[len(region.name):]
+		for _, suffix := range qqwryProvinceSuffixes {
+			if strings.HasPrefix(city, suffix) {
+				city = city[len(suffix):]
+				break
+			}
+		}
+		country = region.name
+		break
+	}
+	for _, name := range qqwryProvinces {
+		if code != "" || !strings.HasPrefix(country, name) {
+			continue
+		}
+		province, city = name, country[len(name):]
+		for _, suffix := range qqwryProvinceSuffixes {
+			if strings.HasPrefix(city, suffix) {
+				province, city = name+suffix, city[len(suffix):]
+				break
+			}
+		}
+		country = "中国"
+		break
+	}
+	if strings.HasSuffix(province, "市") {
+		// 北京市, 上海市... are cities too, followed by their districts
+		city = province
+	}
+	for _, suffix := range qqwryCitySuffixes {
+		if i := strings.Index(city, suffix); i >= 0 {
+			city = city[:i+len(suffix)]
+			break
+		}
+	}
+
+	if code == "" {
+		code = countryCode(country)
+	}
+	if code != "" {
+		record.Country.IsoCode = code
+		record.Country.Names = countryNames(code)
+		record.Country.Names["zh-CN"] = country
+		record.Continent.Code = continentCode(code)
+		record.Continent.Names = continentNames[record.Continent.Code]
+	} else if country != "" {
+		record.Country.Names = map[string]string{"zh-CN": country}
+	}
+	record.Subdivisions = subdivisionsOf("zh-CN", province, city)
+	if city != "" {
+		record.City.Names = map[string]string{"zh-CN": city}
+	}
+	record.Traits.ISP = qqwryISP(area)
+	return &record
+}
+
+// qqwryISP returns the ISPs the ISP names know in area, in English and
+// separated with / as in the mmdb, or area itself when it has none.
+func qqwryISP(area string) string {
+	names := ispNames.Load()
+	var isps []string
+	seen := make(map[string]bool)
+	for rest := area; rest != ""; {
+		matched := false
+		for _, zh := range names.vocabulary {
+			if strings.HasPrefix(rest, zh) {
+				if en := names.english[zh]; !seen[en] {
+					seen[en] = true
+					isps = append(isps, en)
+				}
+				rest = rest[len(zh):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			_, size := utf8.DecodeRuneInString(rest)
+			rest = rest[size:]
+		}
+	}
+	if len(isps) == 0 {
+		return area
+	}
+	return strings.Join(isps, "/")
+}
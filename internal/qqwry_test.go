@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// qqwryBuilder writes a qqwry.dat in memory, for the decoder to read.
+type qqwryBuilder struct {
+	body  []byte
+	index [][2]uint32
+}
+
+func newQQWryBuilder() *qqwryBuilder {
+	return &qqwryBuilder{body: make([]byte, 8)}
+}
+
+func (b *qqwryBuilder) uint32(n uint32) {
+	b.body = binary.LittleEndian.AppendUint32(b.body, n)
+}
+
+func (b *qqwryBuilder) redirect(mode byte, offset uint32) {
+	b.body = append(b.body, mode, byte(offset), byte(offset>>8), byte(offset>>16))
+}
+
+// cstring writes s in GBK and returns its offset.
+func (b *qqwryBuilder) cstring(t *testing.T, s string) uint32 {
+	t.Helper()
+	encoded, err := simplifiedchinese.GBK.NewEncoder().String(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := uint32(len(b.body))
+	b.body = append(append(b.body, encoded...), 0)
+	return offset
+}
+
+// record starts the record of the range first-last, whose strings the
+// caller writes next.
+func (b *qqwryBuilder) record(first, last string) {
+	start := netip.MustParseAddr(first).As4()
+	end := netip.MustParseAddr(last).As4()
+	b.index = append(b.index, [2]uint32{binary.BigEndian.Uint32(start[:]), uint32(len(b.body))})
+	b.uint32(binary.BigEndian.Uint32(end[:]))
+}
+
+func (b *qqwryBuilder) file(t *testing.T) *qqwryFile {
+	t.Helper()
+	first := uint32(len(b.body))
+	for _, entry := range b.index {
+		b.uint32(entry[0])
+		b.body = append(b.body, byte(entry[1]), byte(entry[1]>>8), byte(entry[1]>>16))
+	}
+	binary.LittleEndian.PutUint32(b.body, first)
+	binary.LittleEndian.PutUint32(b.body[4:], uint32(len(b.body))-qqwryIndexSize)
+	q, err := newQQWryFile(b.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestQQWrySearch(t *testing.T) {
+	b := newQQWryBuilder()
+	sharedCountry := b.cstring(t, "广东省深圳市南山区")
+	sharedArea := b.cstring(t, "阿里云BGP数据中心")
+
+	b.record("1.0.0.0", "1.0.0.255")
+	b.cstring(t, "福建省福州市")
+	b.cstring(t, "联通")
+
+	b.record("1.0.1.0", "1.0.3.255")
+	b.redirect(qqwryRedirectMode2, sharedCountry)
+	b.cstring(t, "电信ADSL")
+
+	block := b.cstring(t, "北京市海淀区")
+	b.redirect(qqwryRedirectMode2, sharedArea)
+	b.record("8.8.8.0", "8.8.8.255")
+	b.redirect(qqwryRedirectMode1, block)
+
+	block = uint32(len(b.body))
+	b.redirect(qqwryRedirectMode2, sharedCountry)
+	b.cstring(t, "移动")
+	b.record("9.9.9.0", "9.9.9.255")
+	b.redirect(qqwryRedirectMode1, block)
+	q := b.file(t)
+
+	tests := []struct {
+		addr          string
+		country, area string
+		first, last   string
+		ok            bool
+	}{
+		{"1.0.0.7", "福建省福州市", "联通", "1.0.0.0", "1.0.0.255", true},
+		{"1.0.2.1", "广东省深圳市南山区", "电信ADSL", "1.0.1.0", "1.0.3.255", true},
+		{"8.8.8.8", "北京市海淀区", "阿里云BGP数据中心", "8.8.8.0", "8.8.8.255", true},
+		{"9.9.9.9", "广东省深圳市南山区", "移动", "9.9.9.0", "9.9.9.255", true},
+		{"0.1.2.3", "", "", "", "", false},
+		{"1.0.4.0", "", "", "", "", false},
+		{"9.9.10.0", "", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			a4 := netip.MustParseAddr(tt.addr).As4()
+			country, area, start, end, ok := q.search(binary.BigEndian.Uint32(a4[:]))
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got := decodeGBK(country); got != tt.country {
+				t.Errorf("country = %q, want %q", got, tt.country)
+			}
+			if got := decodeGBK(area); got != tt.area {
+				t.Errorf("area = %q, want %q", got, tt.area)
+			}
+			if got := netip.AddrFrom4(uint32Bytes(start)).String(); got != tt.first {
+				t.Errorf("first = %s, want %s", got, tt.first)
+			}
+			if got := netip.AddrFrom4(uint32Bytes(end)).String(); got != tt.last {
+				t.Errorf("last = %s, want %s", got, tt.last)
+			}
+		})
+	}
+}
+
+func TestNewQQWryFileInvalid(t *testing.T) {
+	for name, content := range map[string][]byte{
+		"truncated":     {1, 2, 3},
+		"index outside": {8, 0, 0, 0, 100, 0, 0, 0},
+		"index reverse": {20, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		if _, err := newQQWryFile(content); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestQQWryReleaseDate(t *testing.T) {
+	b := newQQWryBuilder()
+	b.record("1.0.0.0", "1.0.0.255")
+	b.cstring(t, "福建省福州市")
+	b.cstring(t, "联通")
+	if _, ok := b.file(t).releaseDate(); ok {
+		t.Error("found a release date in a file without one")
+	}
+
+	b = newQQWryBuilder()
+	b.record("1.0.0.0", "1.0.0.255")
+	b.cstring(t, "福建省福州市")
+	b.cstring(t, "联通")
+	b.record("255.255.255.0", "255.255.255.255")
+	b.cstring(t, "纯真网络")
+	b.cstring(t, "2024年1月10日IP数据")
+	date, ok := b.file(t).releaseDate()
+	if want := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC); !ok || !date.Equal(want) {
+		t.Errorf("releaseDate = %s, %v, want %s", date, ok, want)
+	}
+}
+
+func TestQQWryRecord(t *testing.T) {
+	tests := []struct {
+		country, area string
+		code          string
+		countryName   string
+		region, city  string
+	}{
+		{country: "广东省深圳市南山区", code: "CN", countryName: "中国", region: "广东省", city: "深圳市"},
+		{country: "北京市海淀区", code: "CN", countryName: "中国", region: "北京市", city: "北京市"},
+		{country: "新疆维吾尔自治区乌鲁木齐市", code: "CN", countryName: "中国", region: "新疆维吾尔自治区", city: "乌鲁木齐市"},
+		{country: "内蒙古呼伦贝尔盟", code: "CN", countryName: "中国", region: "内蒙古", city: "呼伦贝尔盟"},
+		{country: "香港", code: "HK", countryName: "香港"},
+		{country: "香港特别行政区", code: "HK", countryName: "香港"},
+		{country: "澳门", code: "MO", countryName: "澳门"},
+		{country: "台湾省台北市", code: "TW", countryName: "台湾", city: "台北市"},
+		{country: "美国", area: " CZ88.NET", code: "US", countryName: "美国"},
+		{country: "局域网", countryName: "局域网"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.country, func(t *testing.T) {
+			record := qqwryRecord(tt.country, tt.area)
+			if record.Country.IsoCode != tt.code || record.Country.Names["zh-CN"] != tt.countryName {
+				t.Errorf("country = %s %q, want %s %q", record.Country.IsoCode, record.Country.Names["zh-CN"], tt.code, tt.countryName)
+			}
+			var region string
+			if len(record.Subdivisions) > 0 {
+				region = record.Subdivisions[0].Names["zh-CN"]
+			}
+			if region != tt.region || record.City.Names["zh-CN"] != tt.city {
+				t.Errorf("region, city = %q, %q, want %q, %q", region, record.City.Names["zh-CN"], tt.region, tt.city)
+			}
+		})
+	}
+}
+
+func TestIsQQWry(t *testing.T) {
+	b := newQQWryBuilder()
+	b.record("1.0.0.0", "1.0.0.255")
+	b.cstring(t, "福建省福州市")
+	b.cstring(t, "联通")
+	content := b.file(t).content
+	dir := t.TempDir()
+	write := func(name string, content []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{name: "qqwry", path: write("qqwry.dat", content), want: true},
+		{name: "upper case extension", path: write("QQWRY.DAT", content), want: true},
+		{name: "other extension", path: write("qqwry.bin", content)},
+		{name: "other format", path: write("GeoIP.dat", []byte("\xff\xff\xff\x02\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))},
+		{name: "trailing bytes", path: write("trailing.dat", append(append([]byte(nil), content...), 0))},
+		{name: "truncated index", path: write("truncated.dat", content[:len(content)-1])},
+		{name: "header only", path: write("header.dat", content[:8])},
+		{name: "missing", path: filepath.Join(dir, "missing.dat")},
+	}
+	for _, tt := range tests {
+		if got := IsQQWry(tt.path); got != tt.want {
+			t.Errorf("%s: IsQQWry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
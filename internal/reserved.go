@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"net/netip"
+	"sort"
+)
+
+// ReservedRange is a special-purpose range of addresses, which no database
+// locates: private networks, loopback, documentation and the like.
+type ReservedRange struct {
+	Network netip.Prefix `json:"-"`
+	// Name is the name of the range in the IANA registries.
+	Name string `json:"name"`
+	RFC  string `json:"rfc"`
+}
+
+// reservedRanges are the IANA IPv4 and IPv6 special-purpose address
+// registries, plus the multicast ranges, most specific first.
+var reservedRanges = []*ReservedRange{
+	{Network: netip.MustParsePrefix("0.0.0.0/8"), Name: "This network", RFC: "RFC 791"},
+	{Network: netip.MustParsePrefix("0.0.0.0/32"), Name: "This host on this network", RFC: "RFC 1122"},
+	{Network: netip.MustParsePrefix("10.0.0.0/8"), Name: "Private-Use", RFC: "RFC 1918"},
+	{Network: netip.MustParsePrefix("100.64.0.0/10"), Name: "Shared Address Space", RFC: "RFC 6598"},
+	{Network: netip.MustParsePrefix("127.0.0.0/8"), Name: "Loopback", RFC: "RFC 1122"},
+	{Network: netip.MustParsePrefix("169.254.0.0/16"), Name: "Link Local", RFC: "RFC 3927"},
+	{Network: netip.MustParsePrefix("172.16.0.0/12"), Name: "Private-Use", RFC: "RFC 1918"},
+	{Network: netip.MustParsePrefix("192.0.0.0/24"), Name: "IETF Protocol Assignments", RFC: "RFC 6890"},
+	{Network: netip.MustParsePrefix("192.0.0.0/29"), Name: "IPv4 Service Continuity Prefix", RFC: "RFC 7335"},
+	{Network: netip.MustParsePrefix("192.0.0.8/32"), Name: "IPv4 dummy address", RFC: "RFC 7600"},
+	{Network: netip.MustParsePrefix("192.0.0.9/32"), Name: "Port Control Protocol Anycast", RFC: "RFC 7723"},
+	{Network: netip.MustParsePrefix("192.0.0.10/32"), Name: "Traversal Using Relays around NAT Anycast", RFC: "RFC 8155"},
+	{Network: netip.MustParsePrefix("192.0.0.170/32"), Name: "NAT64/DNS64 Discovery", RFC: "RFC 8880"},
+	{Network: netip.MustParsePrefix("192.0.0.171/32"), Name: "NAT64/DNS64 Discovery", RFC: "RFC 8880"},
+	{Network: netip.MustParsePrefix("192.0.2.0/24"), Name: "Documentation (TEST-NET-1)", RFC: "RFC 5737"},
+	{Network: netip.MustParsePrefix("192.31.196.0/24"), Name: "AS112-v4", RFC: "RFC 7535"},
+	{Network: netip.MustParsePrefix("192.52.193.0/24"), Name: "AMT", RFC: "RFC 7450"},
+	{Network: netip.MustParsePrefix("192.88.99.0/24"), Name: "Deprecated (6to4 Relay Anycast)", RFC: "RFC 7526"},
+	{Network: netip.MustParsePrefix("192.168.0.0/16"), Name: "Private-Use", RFC: "RFC 1918"},
+	{Network: netip.MustParsePrefix("192.175.48.0/24"), Name: "Direct Delegation AS112 Service", RFC: "RFC 7534"},
+	{Network: netip.MustParsePrefix("198.18.0.0/15"), Name: "Benchmarking", RFC: "RFC 2544"},
+	{Network: netip.MustParsePrefix("198.51.100.0/24"), Name: "Documentation (TEST-NET-2)", RFC: "RFC 5737"},
+	{Network: netip.MustParsePrefix("203.0.113.0/24"), Name: "Documentation (TEST-NET-3)", RFC: "RFC 5737"},
+	{Network: netip.MustParsePrefix("224.0.0.0/4"), Name: "Multicast", RFC: "RFC 5771"},
+	{Network: netip.MustParsePrefix("240.0.0.0/4"), Name: "Reserved", RFC: "RFC 1112"},
+	{Network: netip.MustParsePrefix("255.255.255.255/32"), Name: "Limited Broadcast", RFC: "RFC 919"},
+
+	{Network: netip.MustParsePrefix("::1/128"), Name: "Loopback Address", RFC: "RFC 4291"},
+	{Network: netip.MustParsePrefix("::/128"), Name: "Unspecified Address", RFC: "RFC 4291"},
+	{Network: netip.MustParsePrefix("::ffff:0:0/96"), Name: "IPv4-mapped Address", RFC: "RFC 4291"},
+	{Network: netip.MustParsePrefix("64:ff9b::/96"), Name: "IPv4-IPv6 Translat.", RFC: "RFC 6052"},
+	{Network: netip.MustParsePrefix("64:ff9b:1::/48"), Name: "IPv4-IPv6 Translat.", RFC: "RFC 8215"},
+	{Network: netip.MustParsePrefix("100::/64"), Name: "Discard-Only Address Block", RFC: "RFC 6666"},
+	{Network: netip.MustParsePrefix("2001::/23"), Name: "IETF Protocol Assignments", RFC: "RFC 2928"},
+	{Network: netip.MustParsePrefix("2001::/32"), Name: "TEREDO", RFC: "RFC 4380"},
+	{Network: netip.MustParsePrefix("2001:1::1/128"), Name: "Port Control Protocol Anycast", RFC: "RFC 7723"},
+	{Network: netip.MustParsePrefix("2001:1::2/128"), Name: "Traversal Using Relays around NAT Anycast", RFC: "RFC 8155"},
+	{Network: netip.MustParsePrefix("2001:1::3/128"), Name: "DNS-SD Service Registration Protocol Anycast", RFC: "RFC 9665"},
+	{Network: netip.MustParsePrefix("2001:2::/48"), Name: "Benchmarking", RFC: "RFC 5180"},
+	{Network: netip.MustParsePrefix("2001:3::/32"), Name: "AMT", RFC: "RFC 7450"},
+	{Network: netip.MustParsePrefix("2001:4:112::/48"), Name: "AS112-v6", RFC: "RFC 7535"},
+	{Network: netip.MustParsePrefix("2001:10::/28"), Name: "Deprecated (previously ORCHID)", RFC: "RFC 4843"},
+	{Network: netip.MustParsePrefix("2001:20::/28"), Name: "ORCHIDv2", RFC: "RFC 7343"},
+	{Network: netip.MustParsePrefix("2001:30::/28"), Name: "Drone Remote ID Protocol Entity Tags (DETs) Prefix", RFC: "RFC 9374"},
+	{Network: netip.MustParsePrefix("2001:db8::/32"), Name: "Documentation", RFC: "RFC 3849"},
+	{Network: netip.MustParsePrefix("2002::/16"), Name: "6to4", RFC: "RFC 3056"},
+	{Network: netip.MustParsePrefix("2620:4f:8000::/48"), Name: "Direct Delegation AS112 Service", RFC: "RFC 7534"},
+	{Network: netip.MustParsePrefix("3fff::/20"), Name: "Documentation", RFC: "RFC 9637"},
+	{Network: netip.MustParsePrefix("5f00::/16"), Name: "Segment Routing (SRv6) SIDs", RFC: "RFC 9602"},
+	{Network: netip.MustParsePrefix("fc00::/7"), Name: "Unique-Local", RFC: "RFC 4193"},
+	{Network: netip.MustParsePrefix("fe80::/10"), Name: "Link-Local Unicast", RFC: "RFC 4291"},
+	{Network: netip.MustParsePrefix("ff00::/8"), Name: "Multicast", RFC: "RFC 4291"},
+}
+
+func init() {
+	sort.SliceStable(reservedRanges, func(i, j int) bool {
+		return reservedRanges[i].Network.Bits() > reservedRanges[j].Network.Bits()
+	})
+}
+
+// LookupReserved returns the most specific special-purpose range addr is
+// in, or nil when it is an ordinary address. IPv4-mapped addresses are
+// looked up as IPv4.
+func LookupReserved(addr netip.Addr) *ReservedRange {
+	addr = addr.WithZone("").Unmap()
+	for _, r := range reservedRanges {
+		if r.Network.Contains(addr) {
+			return r
+		}
+	}
+	return nil
+}
+
+// reservedNetwork returns the largest network within the range r of addr
+// that no more specific range cuts.
+func reservedNetwork(addr netip.Addr, r *ReservedRange) netip.Prefix {
+	addr = addr.WithZone("").Unmap()
+	length := r.Network.Bits()
+	for _, other := range reservedRanges {
+		if other.Network.Bits() <= length || !r.Network.Overlaps(other.Network) {
+			continue
+		}
+		if common := commonBits(addr, other.Network.Addr()); common+1 > length {
+			length = common + 1
+		}
+	}
+	network, _ := addr.Prefix(length)
+	return network
+}
+
+// reservedLocator answers for special-purpose addresses without asking
+// the databases.
+type reservedLocator struct {
+	Locator
+}
+
+// WithReserved returns a Locator that answers for the addresses of the
+// special-purpose ranges with an IPInfo holding only their Reserved range
+// and its network. Records returned by Lookup are the databases' own.
+func WithReserved(l Locator) Locator {
+	return &reservedLocator{Locator: l}
+}
+
+func (l *reservedLocator) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	r := LookupReserved(addr)
+	if r == nil {
+		return l.Locator.LookupIPInfo(addr, lang)
+	}
+	return &IPInfo{Reserved: r, Network: newNetworkRange(reservedNetwork(addr, r))}, nil
+}
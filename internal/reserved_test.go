@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestLookupReserved(t *testing.T) {
+	tests := []struct {
+		addr    string
+		name    string
+		network string
+	}{
+		{addr: "10.1.2.3", name: "Private-Use", network: "10.0.0.0/8"},
+		{addr: "::ffff:192.168.1.1", name: "Private-Use", network: "192.168.0.0/16"},
+		{addr: "0.0.0.0", name: "This host on this network", network: "0.0.0.0/32"},
+		{addr: "0.0.0.1", name: "This network", network: "0.0.0.1/32"},
+		{addr: "0.128.0.1", name: "This network", network: "0.128.0.0/9"},
+		{addr: "192.0.0.9", name: "Port Control Protocol Anycast", network: "192.0.0.9/32"},
+		{addr: "192.0.0.200", name: "IETF Protocol Assignments", network: "192.0.0.192/26"},
+		{addr: "2001:db8::1", name: "Documentation", network: "2001:db8::/32"},
+		{addr: "2001::1", name: "TEREDO", network: "2001::/32"},
+		{addr: "2001:5::1", name: "IETF Protocol Assignments", network: "2001:5::/32"},
+		{addr: "fe80::1%eth0", name: "Link-Local Unicast", network: "fe80::/10"},
+		{addr: "::1", name: "Loopback Address", network: "::1/128"},
+		{addr: "1.1.1.1"},
+		{addr: "2400:cb00::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			addr := netip.MustParseAddr(tt.addr)
+			r := LookupReserved(addr)
+			if r == nil {
+				if tt.name != "" {
+					t.Fatalf("not reserved, want %s", tt.name)
+				}
+				return
+			}
+			if r.Name != tt.name {
+				t.Errorf("name = %q, want %q", r.Name, tt.name)
+			}
+			if network := reservedNetwork(addr, r); network.String() != tt.network {
+				t.Errorf("network = %s, want %s", network, tt.network)
+			}
+		})
+	}
+}
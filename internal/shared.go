@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var errClosed = errors.New("the database is closed")
+
+// shared is a value along with the count of its users: the holder it is
+// stored in, and the lookups in flight. It is closed when the last of them
+// is done, so that a reloaded file is not closed under a long lookup.
+type shared[T any] struct {
+	value T
+	close func(T) error
+	refs  atomic.Int64
+}
+
+// acquire counts one more user, unless the value is already closed.
+func (s *shared[T]) acquire() bool {
+	for {
+		n := s.refs.Load()
+		if n == 0 {
+			return false
+		}
+		if s.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// release counts one user less and closes the value if it was the last.
+func (s *shared[T]) release() {
+	if s.refs.Add(-1) == 0 {
+		s.close(s.value)
+	}
+}
+
+// sharedHolder holds the value in use, which store replaces at any time.
+type sharedHolder[T any] struct {
+	current atomic.Pointer[shared[T]]
+}
+
+// store makes value the one in use. The value it replaces is closed once
+// the users that acquired it release it.
+func (h *sharedHolder[T]) store(value T, close func(T) error) {
+	s := &shared[T]{value: value, close: close}
+	s.refs.Store(1)
+	if old := h.current.Swap(s); old != nil {
+		old.release()
+	}
+}
+
+// acquire returns the value in use, which stays open until the returned
+// shared is released.
+func (h *sharedHolder[T]) acquire() (*shared[T], error) {
+	for {
+		s := h.current.Load()
+		if s == nil {
+			return nil, errClosed
+		}
+		if s.acquire() {
+			return s, nil
+		}
+		// s was replaced and closed since it was loaded
+	}
+}
+
+// load returns the value in use, for what does not need it open.
+func (h *sharedHolder[T]) load() (T, bool) {
+	var zero T
+	s := h.current.Load()
+	if s == nil {
+		return zero, false
+	}
+	return s.value, true
+}
+
+// close drops the value in use, which is closed once its users are done.
+func (h *sharedHolder[T]) close() {
+	if old := h.current.Swap(nil); old != nil {
+		old.release()
+	}
+}
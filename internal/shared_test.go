@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type sharedValue struct {
+	closed atomic.Int32
+}
+
+func (v *sharedValue) close() error {
+	v.closed.Add(1)
+	return nil
+}
+
+func TestSharedHolder(t *testing.T) {
+	var h sharedHolder[*sharedValue]
+	if _, err := h.acquire(); err == nil {
+		t.Fatal("acquired an empty holder")
+	}
+
+	first, second := new(sharedValue), new(sharedValue)
+	h.store(first, (*sharedValue).close)
+	s, err := h.acquire()
+	if err != nil || s.value != first {
+		t.Fatalf("acquire = %v, %v", s, err)
+	}
+	h.store(second, (*sharedValue).close)
+	if first.closed.Load() != 0 {
+		t.Fatal("the replaced value was closed while in use")
+	}
+	s.release()
+	if first.closed.Load() != 1 {
+		t.Fatal("the replaced value was not closed by its last user")
+	}
+
+	if s, err = h.acquire(); err != nil || s.value != second {
+		t.Fatalf("acquire = %v, %v", s, err)
+	}
+	h.close()
+	if second.closed.Load() != 0 {
+		t.Fatal("the value was closed while in use")
+	}
+	s.release()
+	if second.closed.Load() != 1 {
+		t.Fatal("the value was not closed by its last user")
+	}
+	if _, err := h.acquire(); err == nil {
+		t.Fatal("acquired a closed holder")
+	}
+}
+
+func TestSharedHolderConcurrent(t *testing.T) {
+	var h sharedHolder[*sharedValue]
+	values := make([]*sharedValue, 100)
+	for i := range values {
+		values[i] = new(sharedValue)
+	}
+	h.store(values[0], (*sharedValue).close)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				s, err := h.acquire()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if s.value.closed.Load() != 0 {
+					t.Error("acquired a closed value")
+				}
+				s.release()
+			}
+		}()
+	}
+	for _, v := range values[1:] {
+		h.store(v, (*sharedValue).close)
+	}
+	close(stop)
+	wg.Wait()
+	h.close()
+	for i, v := range values {
+		if n := v.closed.Load(); n != 1 {
+			t.Errorf("value %d closed %d times", i, n)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The Traditional Chinese languages of the answers. The names the databases
+// do not have in them are converted from the zh-CN ones.
+const (
+	LanguageTaiwan   = "zh-TW"
+	LanguageHongKong = "zh-HK"
+)
+
+// hantCommonPhrases are converted as a whole rather than character by
+// character, in both Taiwan and Hong Kong.
+var hantCommonPhrases = map[string]string{
+	"沈阳":    "瀋陽",
+	"皇后":    "皇后",
+	"王后":    "王后",
+	"太后":    "太后",
+	"头发":    "頭髮",
+	"理发":    "理髮",
+	"复杂":    "複雜",
+	"重复":    "重複",
+	"复制":    "複製",
+	"回复":    "回覆",
+	"联系":    "聯繫",
+	"关系":    "關係",
+	"来自于":   "來自於",
+	"属于":    "屬於",
+	"位于":    "位於",
+	"由于":    "由於",
+	"对于":    "對於",
+	"关于":    "關於",
+	"等于":    "等於",
+	"终于":    "終於",
+	"至于":    "至於",
+	"在于":    "在於",
+	"于是":    "於是",
+	"词汇":    "詞彙",
+	"心脏":    "心臟",
+	"日历":    "日曆",
+	"台风":    "颱風",
+	"干燥":    "乾燥",
+	"干净":    "乾淨",
+	"干部":    "幹部",
+	"干线":    "幹線",
+	"骨干":    "骨幹",
+	"主干":    "主幹",
+	"范围":    "範圍",
+	"规范":    "規範",
+	"冲突":    "衝突",
+	"冲击":    "衝擊",
+	"合并":    "合併",
+	"制造":    "製造",
+	"葵涌":    "葵涌",
+	"鲗鱼涌":   "鰂魚涌",
+	"澳大利亚":  "澳洲",
+	"印度尼西亚": "印尼",
+}
+
+// hantPhrases are the phrases of each Traditional Chinese language, where
+// the vocabulary of Taiwan and Hong Kong differs: computing terms, and the
+// transliterations of countries and cities.
+var hantPhrases = map[string]map[string]string{
+	LanguageTaiwan: {
+		"恒":          "恆",
+		"里面":         "裡面",
+		"当前":         "目前",
+		"默认":         "預設",
+		"用户":         "使用者",
+		"运营商":        "電信業者",
+		"地址段":        "位址段",
+		"你的地址":       "你的位址",
+		"通过":         "透過",
+		"信息":         "資訊",
+		"网络":         "網路",
+		"互联网":        "網際網路",
+		"数据中心":       "資料中心",
+		"数据":         "資料",
+		"数码":         "數位",
+		"软件":         "軟體",
+		"硬件":         "硬體",
+		"宽带":         "寬頻",
+		"云计算":        "雲端運算",
+		"服务器":        "伺服器",
+		"蜂窝网络":       "行動網路",
+		"视频":         "影音",
+		"通信":         "通訊",
+		"意大利":        "義大利",
+		"新西兰":        "紐西蘭",
+		"沙特阿拉伯":      "沙烏地阿拉伯",
+		"阿拉伯联合酋长国":   "阿拉伯聯合大公國",
+		"老挝":         "寮國",
+		"也门":         "葉門",
+		"索马里":        "索馬利亞",
+		"肯尼亚":        "肯亞",
+		"坦桑尼亚":       "坦尚尼亞",
+		"尼日利亚":       "奈及利亞",
+		"尼日尔":        "尼日",
+		"埃塞俄比亚":      "衣索比亞",
+		"厄立特里亚":      "厄利垂亞",
+		"吉布提":        "吉布地",
+		"毛里求斯":       "模里西斯",
+		"毛里塔尼亚":      "茅利塔尼亞",
+		"博茨瓦纳":       "波札那",
+		"津巴布韦":       "辛巴威",
+		"赞比亚":        "尚比亞",
+		"莫桑比克":       "莫三比克",
+		"卢旺达":        "盧安達",
+		"布基纳法索":      "布吉納法索",
+		"加纳":         "迦納",
+		"贝宁":         "貝南",
+		"利比里亚":       "賴比瑞亞",
+		"塞拉利昂":       "獅子山",
+		"冈比亚":        "甘比亞",
+		"乍得":         "查德",
+		"加蓬":         "加彭",
+		"科特迪瓦":       "象牙海岸",
+		"马拉维":        "馬拉威",
+		"莱索托":        "賴索托",
+		"塞舌尔":        "塞席爾",
+		"科摩罗":        "葛摩",
+		"佛得角":        "維德角",
+		"突尼斯":        "突尼西亞",
+		"危地马拉":       "瓜地馬拉",
+		"洪都拉斯":       "宏都拉斯",
+		"哥斯达黎加":      "哥斯大黎加",
+		"伯利兹":        "貝里斯",
+		"圭亚那":        "蓋亞那",
+		"苏里南":        "蘇利南",
+		"厄瓜多尔":       "厄瓜多",
+		"巴巴多斯":       "巴貝多",
+		"特立尼达和多巴哥":   "千里達及托巴哥",
+		"格林纳达":       "格瑞那達",
+		"安提瓜和巴布达":    "安地卡及巴布達",
+		"波斯尼亚和黑塞哥维那": "波士尼亞與赫塞哥維納",
+		"克罗地亚":       "克羅埃西亞",
+		"斯洛文尼亚":      "斯洛維尼亞",
+		"塞浦路斯":       "賽普勒斯",
+		"格鲁吉亚":       "喬治亞",
+		"马耳他":        "馬爾他",
+		"圣马力诺":       "聖馬利諾",
+		"列支敦士登":      "列支敦斯登",
+		"哈萨克斯坦":      "哈薩克",
+		"乌兹别克斯坦":     "烏茲別克",
+		"吉尔吉斯斯坦":     "吉爾吉斯",
+		"塔吉克斯坦":      "塔吉克",
+		"土库曼斯坦":      "土庫曼",
+		"阿塞拜疆":       "亞塞拜然",
+		"卡塔尔":        "卡達",
+		"文莱":         "汶萊",
+		"马尔代夫":       "馬爾地夫",
+		"巴布亚新几内亚":    "巴布亞紐幾內亞",
+		"瓦努阿图":       "萬那杜",
+		"所罗门群岛":      "索羅門群島",
+		"汤加":         "東加",
+		"基里巴斯":       "吉里巴斯",
+		"图瓦卢":        "吐瓦魯",
+		"瑙鲁":         "諾魯",
+		"帕劳":         "帛琉",
+		"悉尼":         "雪梨",
+		"新泽西":        "紐澤西",
+		"新罕布什尔":      "新罕布夏",
+		"迪拜":         "杜拜",
+		"阿布扎比":       "阿布達比",
+		"伊斯坦布尔":      "伊斯坦堡",
+		"休斯敦":        "休士頓",
+		"巴塞罗那":       "巴塞隆納",
+		"圣地亚哥":       "聖地牙哥",
+		"珀斯":         "伯斯",
+		"阿德莱德":       "阿得雷德",
+		"堪培拉":        "坎培拉",
+		"内罗毕":        "奈洛比",
+		"约翰内斯堡":      "約翰尼斯堡",
+		"萨格勒布":       "札格雷布",
+		"贝尔格莱德":      "貝爾格勒",
+		"利雅得":        "利雅德",
+		"科伦坡":        "可倫坡",
+		"卡拉奇":        "喀拉蚩",
+	},
+	LanguageHongKong: {
+		"里面":      "裏面",
+		"默认":      "預設",
+		"运营商":     "營運商",
+		"信息":      "資訊",
+		"网络":      "網絡",
+		"互联网":     "互聯網",
+		"数据中心":    "數據中心",
+		"软件":      "軟件",
+		"硬件":      "硬件",
+		"宽带":      "寬頻",
+		"云计算":     "雲計算",
+		"服务器":     "伺服器",
+		"蜂窝网络":    "流動網絡",
+		"通信":      "通訊",
+		"沙特阿拉伯":   "沙地阿拉伯",
+		"毛里求斯":    "毛里裘斯",
+		"巴布亚新几内亚": "巴布亞新畿內亞",
+		"巴塞罗那":    "巴塞隆拿",
+	},
+}
+
+// hantConverter converts zh-CN text to one Traditional Chinese language,
+// preferring the longest phrase that starts at each character.
+type hantConverter struct {
+	phrases map[string]string
+	// longest is the length in runes of the longest phrase.
+	longest int
+}
+
+var (
+	hantRunes      = make(map[rune]rune)
+	hantConverters = make(map[string]*hantConverter)
+)
+
+func init() {
+	for _, pair := range strings.Fields(hantChars) {
+		simplified, size := utf8.DecodeRuneInString(pair)
+		traditional, _ := utf8.DecodeRuneInString(pair[size:])
+		hantRunes[simplified] = traditional
+	}
+	for lang, regional := range hantPhrases {
+		c := &hantConverter{phrases: make(map[string]string, len(hantCommonPhrases)+len(regional))}
+		for _, phrases := range []map[string]string{hantCommonPhrases, regional} {
+			for simplified, traditional := range phrases {
+				c.phrases[simplified] = traditional
+				if n := utf8.RuneCountInString(simplified); n > c.longest {
+					c.longest = n
+				}
+			}
+		}
+		hantConverters[lang] = c
+	}
+}
+
+func (c *hantConverter) convert(s string) string {
+	// the offsets of the runes of s, and of its end
+	offsets := make([]int, 0, len(s)+1)
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(s))
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(offsets)-1; {
+		n := c.longest
+		if rest := len(offsets) - 1 - i; n > rest {
+			n = rest
+		}
+		for ; n > 0; n-- {
+			if phrase, ok := c.phrases[s[offsets[i]:offsets[i+n]]]; ok {
+				b.WriteString(phrase)
+				break
+			}
+		}
+		if n > 0 {
+			i += n
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(s[offsets[i]:])
+		if traditional, ok := hantRunes[r]; ok {
+			r = traditional
+		}
+		b.WriteRune(r)
+		i++
+	}
+	return b.String()
+}
+
+// ToTraditional converts the zh-CN text s to lang when it is one of the
+// Traditional Chinese languages, and returns it as is otherwise.
+func ToTraditional(s, lang string) string {
+	c, ok := hantConverters[lang]
+	if !ok {
+		return s
+	}
+	return c.convert(s)
+}
+
+// isTraditional reports whether lang is one of the Traditional Chinese
+// languages zh-CN names are converted to.
+func isTraditional(lang string) bool {
+	_, ok := hantConverters[lang]
+	return ok
+}
+
+// toTraditional converts name, found in lang for an answer in the first
+// language of chain, when that one is a Traditional Chinese language and
+// name is a zh-CN one. The converted name is in the language of the answer.
+func toTraditional(name, lang string, chain []string) (string, string) {
+	if lang != "zh-CN" || name == "" {
+		return name, lang
+	}
+	c, ok := hantConverters[chain[0]]
+	if !ok {
+		return name, lang
+	}
+	return c.convert(name), chain[0]
+}
@@ -0,0 +1,103 @@
+package internal
+
+import "net/netip"
+
+// The IPv6 transition mechanisms that embed an IPv4 address.
+const (
+	TunnelIPv4Mapped = "ipv4-mapped"
+	Tunnel6to4       = "6to4"
+	TunnelTeredo     = "teredo"
+	TunnelNAT64      = "nat64"
+	TunnelISATAP     = "isatap"
+)
+
+var (
+	prefix6to4          = netip.MustParsePrefix("2002::/16")
+	prefixTeredo        = netip.MustParsePrefix("2001::/32")
+	prefixNAT64         = netip.MustParsePrefix("64:ff9b::/96")
+	prefixNAT64LocalUse = netip.MustParsePrefix("64:ff9b:1::/48")
+	isatapInterfaceIDs  = [][4]byte{{0x00, 0x00, 0x5e, 0xfe}, {0x02, 0x00, 0x5e, 0xfe}}
+)
+
+// Tunnel tells that an answer is the one of the IPv4 address embedded in
+// the IPv6 address that was asked for.
+type Tunnel struct {
+	// Type is one of the Tunnel constants.
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	IPv4    string `json:"ipv4"`
+}
+
+// EmbeddedIPv4 returns the IPv4 address that addr embeds and the
+// transition mechanism it embeds it with, or false when addr is not a
+// transition address.
+//
+// Teredo addresses embed the address of the client, not the one of the
+// server. NAT64 addresses are recognized under the well-known prefix and
+// the local-use one of RFC 8215, and ISATAP ones by their interface
+// identifier under any global unicast prefix that is not special-purpose,
+// so that documentation or link-local addresses are left as they are.
+func EmbeddedIPv4(addr netip.Addr) (netip.Addr, string, bool) {
+	if !addr.Is6() || addr.Zone() != "" {
+		return netip.Addr{}, "", false
+	}
+	a := addr.As16()
+	switch {
+	case addr.Is4In6():
+		return addr.Unmap(), TunnelIPv4Mapped, true
+	case prefix6to4.Contains(addr):
+		return netip.AddrFrom4([4]byte{a[2], a[3], a[4], a[5]}), Tunnel6to4, true
+	case prefixTeredo.Contains(addr):
+		// the client address is stored with its bits flipped
+		return netip.AddrFrom4([4]byte{^a[12], ^a[13], ^a[14], ^a[15]}), TunnelTeredo, true
+	case prefixNAT64.Contains(addr):
+		return netip.AddrFrom4([4]byte{a[12], a[13], a[14], a[15]}), TunnelNAT64, true
+	case prefixNAT64LocalUse.Contains(addr):
+		// RFC 6052 skips bits 64 to 71 of the address
+		return netip.AddrFrom4([4]byte{a[6], a[7], a[9], a[10]}), TunnelNAT64, true
+	}
+	if !addr.IsGlobalUnicast() || LookupReserved(addr) != nil {
+		return netip.Addr{}, "", false
+	}
+	for _, id := range isatapInterfaceIDs {
+		if [4]byte{a[8], a[9], a[10], a[11]} == id {
+			return netip.AddrFrom4([4]byte{a[12], a[13], a[14], a[15]}), TunnelISATAP, true
+		}
+	}
+	return netip.Addr{}, "", false
+}
+
+// tunnelLocator answers for transition addresses with the answers of the
+// IPv4 addresses they embed.
+type tunnelLocator struct {
+	Locator
+}
+
+// WithTunnels returns a Locator that looks up the IPv4 address embedded in
+// IPv6 transition addresses instead of them, and tells so in the Tunnel of
+// its IPv4 infos.
+func WithTunnels(l Locator) Locator {
+	return &tunnelLocator{Locator: l}
+}
+
+func (l *tunnelLocator) Lookup(addr netip.Addr) (*Record, error) {
+	if ipv4, _, ok := EmbeddedIPv4(addr); ok {
+		addr = ipv4
+	}
+	return l.Locator.Lookup(addr)
+}
+
+func (l *tunnelLocator) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	ipv4, tunnel, ok := EmbeddedIPv4(addr)
+	if !ok {
+		return l.Locator.LookupIPInfo(addr, lang)
+	}
+	info, err := l.Locator.LookupIPInfo(ipv4, lang)
+	if err != nil {
+		return nil, err
+	}
+	// info may be shared
+	tunneled := *info
+	tunneled.Tunnel = &Tunnel{Type: tunnel, Address: addr.String(), IPv4: ipv4.String()}
+	return &tunneled, nil
+}
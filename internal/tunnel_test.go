@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestEmbeddedIPv4(t *testing.T) {
+	tests := []struct {
+		addr   string
+		ipv4   string
+		tunnel string
+	}{
+		{addr: "::ffff:1.2.3.4", ipv4: "1.2.3.4", tunnel: TunnelIPv4Mapped},
+		{addr: "2002:c000:0204::1", ipv4: "192.0.2.4", tunnel: Tunnel6to4},
+		{addr: "2001:0:4136:e378:8000:63bf:3fff:fdd2", ipv4: "192.0.2.45", tunnel: TunnelTeredo},
+		{addr: "64:ff9b::1.2.3.4", ipv4: "1.2.3.4", tunnel: TunnelNAT64},
+		{addr: "64:ff9b:1:102:3:400::", ipv4: "1.2.3.4", tunnel: TunnelNAT64},
+		{addr: "2400:cb00::5efe:1.2.3.4", ipv4: "1.2.3.4", tunnel: TunnelISATAP},
+		{addr: "2400:cb00::200:5efe:1.2.3.4", ipv4: "1.2.3.4", tunnel: TunnelISATAP},
+		// ISATAP interface identifiers under special-purpose prefixes
+		{addr: "2001:db8::5efe:1.2.3.4"},
+		{addr: "fe80::5efe:1.2.3.4"},
+		{addr: "fd00::5efe:1.2.3.4"},
+		{addr: "ff02::5efe:1.2.3.4"},
+		{addr: "2400:cb00::1"},
+		{addr: "fe80::5efe:1.2.3.4%eth0"},
+		{addr: "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			ipv4, tunnel, ok := EmbeddedIPv4(netip.MustParseAddr(tt.addr))
+			if ok != (tt.tunnel != "") {
+				t.Fatalf("ok = %v, want %v", ok, tt.tunnel != "")
+			}
+			if !ok {
+				return
+			}
+			if ipv4.String() != tt.ipv4 || tunnel != tt.tunnel {
+				t.Errorf("got %s %s, want %s %s", tunnel, ipv4, tt.tunnel, tt.ipv4)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// OpenOptions are how OpenDB opens a database.
+type OpenOptions struct {
+	// InMemory reads the whole file into memory instead of mapping it, so
+	// that overwriting the file in place cannot change a live reader.
+	InMemory bool
+	// Golden, when set, holds assertions the database must pass before it
+	// is used. It only makes sense for location databases.
+	Golden *Golden
+}
+
+// OpenDB opens the database at path and verifies it, so that a bad or
+// half-copied file is rejected before it is used. The reader is closed when
+// it does not pass.
+func OpenDB(path string, opts OpenOptions) (*geoip2.Reader, error) {
+	var reader *geoip2.Reader
+	var err error
+	if opts.InMemory {
+		var bytes []byte
+		bytes, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		reader, err = geoip2.FromBytes(bytes)
+	} else {
+		reader, err = geoip2.Open(path)
+	}
+	if err != nil {
+		// geoip2 hands back the reader of a database of an unknown type
+		if reader != nil {
+			reader.Close()
+		}
+		return nil, err
+	}
+	if err := Verify(reader, opts.Golden); err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("%s failed verification: %w", path, err)
+	}
+	return reader, nil
+}
+
+// Verify checks the metadata and the search tree of the database, then the
+// assertions of golden when it is not nil.
+func Verify(reader *geoip2.Reader, golden *Golden) error {
+	metadata := reader.Metadata()
+	built := time.Unix(int64(metadata.BuildEpoch), 0)
+	if metadata.BuildEpoch == 0 || built.After(time.Now().Add(24*time.Hour)) {
+		return fmt.Errorf("invalid build time %s", built.UTC().Format(time.RFC3339))
+	}
+	if err := reader.Verify(); err != nil {
+		return err
+	}
+	if golden != nil {
+		return golden.Check(&MMDB{reader: reader})
+	}
+	return nil
+}
+
+type goldenEntry struct {
+	addr    netip.Addr
+	country string
+}
+
+// Golden is a list of addresses with the country a database must give them,
+// read from a file of `ip,country_code` lines. An empty country code means
+// the database must not know the address. Lines starting with # are comments.
+type Golden struct {
+	Path    string
+	entries []goldenEntry
+}
+
+func NewGolden(path string) (*Golden, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	golden := &Golden{Path: path}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		addr, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("%s: line %d: %w", path, line, err)
+		}
+		golden.entries = append(golden.entries, goldenEntry{
+			addr:    addr,
+			country: strings.ToUpper(strings.TrimSpace(record[1])),
+		})
+	}
+	if len(golden.entries) == 0 {
+		return nil, fmt.Errorf("%s: no assertions", path)
+	}
+	return golden, nil
+}
+
+// Check looks every address of g up in l and reports all the ones that do
+// not get the expected country.
+func (g *Golden) Check(l Locator) error {
+	var errs []error
+	for _, entry := range g.entries {
+		record, err := l.Lookup(entry.addr)
+		if err != nil {
+			return err
+		}
+		if record.Country.IsoCode != entry.country {
+			errs = append(errs, fmt.Errorf("%s is in %q instead of %q", entry.addr, record.Country.IsoCode, entry.country))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", g.Path, err)
+	}
+	return nil
+}
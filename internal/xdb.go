@@ -0,0 +1,355 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// The layout of an ip2region xdb file: a header, a vector index of 256x256
+// slots holding the first and last segment index block of every /16, then
+// the region strings and the segment index blocks.
+const (
+	xdbHeaderLength     = 256
+	xdbVectorIndexCols  = 256
+	xdbVectorIndexSize  = 8
+	xdbVectorIndexEnd   = xdbHeaderLength + 256*xdbVectorIndexCols*xdbVectorIndexSize
+	xdbSegmentIndexSize = 14
+	xdbStructure20      = 2
+)
+
+// xdbFile is an opened xdb, either fully in memory or as its vector index
+// with the rest read from the file on every lookup.
+type xdbFile struct {
+	content     []byte
+	file        *os.File
+	vectorIndex []byte
+	size        int64
+	// createdAt is the build date of the file in its header, read by verify.
+	createdAt uint32
+}
+
+func openXDBFile(path string, inMemory bool) (*xdbFile, error) {
+	if inMemory {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(content) < xdbVectorIndexEnd {
+			return nil, errors.New("truncated xdb file")
+		}
+		return &xdbFile{
+			content:     content,
+			vectorIndex: content[xdbHeaderLength:xdbVectorIndexEnd],
+			size:        int64(len(content)),
+		}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	x := &xdbFile{file: f, size: info.Size(), vectorIndex: make([]byte, xdbVectorIndexEnd-xdbHeaderLength)}
+	if err := x.read(xdbHeaderLength, x.vectorIndex); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xdbFile) read(offset int64, buf []byte) error {
+	if offset < 0 || offset+int64(len(buf)) > x.size {
+		return fmt.Errorf("xdb offset %d out of range", offset)
+	}
+	if x.content != nil {
+		copy(buf, x.content[offset:])
+		return nil
+	}
+	_, err := x.file.ReadAt(buf, offset)
+	return err
+}
+
+// verify checks the header and that the segment index and the region
+// strings it points to are within the file, so that a half-copied file is
+// rejected when it is opened.
+func (x *xdbFile) verify() error {
+	header := make([]byte, 16)
+	if err := x.read(0, header); err != nil {
+		return err
+	}
+	if version := binary.LittleEndian.Uint16(header); version != xdbStructure20 {
+		return fmt.Errorf("unsupported xdb version %d", version)
+	}
+	x.createdAt = binary.LittleEndian.Uint32(header[4:])
+	start := int64(binary.LittleEndian.Uint32(header[8:]))
+	end := int64(binary.LittleEndian.Uint32(header[12:]))
+	if start < xdbVectorIndexEnd || end < start || end+xdbSegmentIndexSize > x.size ||
+		(end-start)%xdbSegmentIndexSize != 0 {
+		return fmt.Errorf("invalid xdb segment index %d-%d in a file of %d bytes", start, end, x.size)
+	}
+	for _, offset := range []int64{start, end} {
+		block := make([]byte, xdbSegmentIndexSize)
+		if err := x.read(offset, block); err != nil {
+			return err
+		}
+		dataLen := int64(binary.LittleEndian.Uint16(block[8:]))
+		dataPtr := int64(binary.LittleEndian.Uint32(block[10:]))
+		if dataPtr+dataLen > x.size {
+			return fmt.Errorf("xdb region at %d out of range", dataPtr)
+		}
+	}
+	return nil
+}
+
+// search returns the region string of ip and the first and last addresses
+// of its segment, or "" when it is in no segment.
+func (x *xdbFile) search(ip uint32) (region string, start, end uint32, err error) {
+	slot := (int(ip>>24)*xdbVectorIndexCols + int(ip>>16&0xff)) * xdbVectorIndexSize
+	first := int64(binary.LittleEndian.Uint32(x.vectorIndex[slot:]))
+	last := int64(binary.LittleEndian.Uint32(x.vectorIndex[slot+4:]))
+	if first == 0 && last == 0 {
+		return "", 0, 0, nil
+	}
+
+	// last points right after the last segment index block of the /16
+	block := make([]byte, xdbSegmentIndexSize)
+	low, high := int64(0), (last-first)/xdbSegmentIndexSize-1
+	for low <= high {
+		middle := (low + high) / 2
+		if err := x.read(first+middle*xdbSegmentIndexSize, block); err != nil {
+			return "", 0, 0, err
+		}
+		switch {
+		case ip < binary.LittleEndian.Uint32(block):
+			high = middle - 1
+		case ip > binary.LittleEndian.Uint32(block[4:]):
+			low = middle + 1
+		default:
+			region := make([]byte, binary.LittleEndian.Uint16(block[8:]))
+			if err := x.read(int64(binary.LittleEndian.Uint32(block[10:])), region); err != nil {
+				return "", 0, 0, err
+			}
+			return string(region), binary.LittleEndian.Uint32(block), binary.LittleEndian.Uint32(block[4:]), nil
+		}
+	}
+	return "", 0, 0, nil
+}
+
+func (x *xdbFile) close() error {
+	if x.file != nil {
+		return x.file.Close()
+	}
+	return nil
+}
+
+// XDB is the Locator backed by an ip2region xdb file, whose regions are
+// `国家|区域|省份|城市|ISP` in Chinese with 0 for unknown parts. Only IPv4
+// is covered. The province and the city stay in Chinese in en answers.
+type XDB struct {
+	Path string
+	// InMemory loads the whole file instead of only its vector index.
+	InMemory bool
+	// Golden, when set, holds assertions the file must pass to be loaded.
+	Golden *Golden
+	xdb    sharedHolder[*xdbFile]
+}
+
+func NewXDB(path string, inMemory bool, golden *Golden) (*XDB, error) {
+	db := &XDB{Path: path, InMemory: inMemory, Golden: golden}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// IsXDB reports whether path names an ip2region xdb file by its extension.
+func IsXDB(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".xdb")
+}
+
+// Reload opens the file again. The file in use is kept if the new one
+// cannot be opened or fails verification, and closed once the lookups in
+// flight are done otherwise.
+func (db *XDB) Reload() error {
+	x, err := openXDBFile(db.Path, db.InMemory)
+	if err != nil {
+		return fmt.Errorf("%s: %w", db.Path, err)
+	}
+	if err := x.verify(); err != nil {
+		x.close()
+		return fmt.Errorf("%s failed verification: %w", db.Path, err)
+	}
+	if db.Golden != nil {
+		candidate := &XDB{Path: db.Path}
+		// x is closed below if it fails, and owned by db otherwise
+		candidate.xdb.store(x, func(*xdbFile) error { return nil })
+		if err := db.Golden.Check(candidate); err != nil {
+			x.close()
+			return fmt.Errorf("%s failed verification: %w", db.Path, err)
+		}
+	}
+	db.xdb.store(x, (*xdbFile).close)
+	return nil
+}
+
+// Lookup returns the record of addr. IPv6 addresses, and IPv4 ones in no
+// segment, get an empty record.
+func (db *XDB) Lookup(addr netip.Addr) (*Record, error) {
+	if !addr.IsValid() {
+		return nil, fmt.Errorf("%s is not a valid ip address", addr)
+	}
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return &Record{}, nil
+	}
+	a4 := addr.As4()
+	x, err := db.xdb.acquire()
+	if err != nil {
+		return nil, err
+	}
+	region, start, end, err := x.value.search(binary.BigEndian.Uint32(a4[:]))
+	x.release()
+	if err != nil {
+		return nil, err
+	}
+	record := xdbRecord(region)
+	if region != "" {
+		record.Traits.Network = rangePrefix(netip.AddrFrom4(uint32Bytes(start)), netip.AddrFrom4(uint32Bytes(end)), addr).String()
+	}
+	return record, nil
+}
+
+func (db *XDB) LookupIPInfo(addr netip.Addr, lang string) (*IPInfo, error) {
+	record, err := db.Lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	return GetIPInfoFromLocationISP(record, lang), nil
+}
+
+// Databases describes the file, dated as in its header.
+func (db *XDB) Databases() []DatabaseInfo {
+	info := DatabaseInfo{
+		Role:         RoleLocation,
+		Path:         db.Path,
+		DatabaseType: "ip2region xdb",
+		Languages:    []string{"zh-CN"},
+		IPVersion:    4,
+	}
+	if x, ok := db.xdb.load(); ok {
+		info.BuildEpoch = uint(x.createdAt)
+	}
+	return []DatabaseInfo{info}
+}
+
+// Close closes the file once the lookups in flight are done.
+func (db *XDB) Close() error {
+	db.xdb.close()
+	return nil
+}
+
+// xdbRecord maps a region string to a record the way the dbip's mmdb has
+// it: the province is the first subdivision and the city the second.
+func xdbRecord(region string) *Record {
+	var record Record
+	fields := strings.Split(region, "|")
+	for len(fields) < 5 {
+		fields = append(fields, "")
+	}
+	for i, field := range fields {
+		if field == "0" {
+			fields[i] = ""
+		}
+	}
+	country, province, city, isp := fields[0], fields[2], fields[3], fields[4]
+
+	if country != "" {
+		code := countryCode(country)
+		record.Country.IsoCode = code
+		record.Country.Names = countryNames(code)
+		if record.Country.Names == nil {
+			record.Country.Names = map[string]string{}
+		}
+		record.Country.Names["zh-CN"] = country
+		record.Continent.Code = continentCode(code)
+		record.Continent.Names = continentNames[record.Continent.Code]
+	}
+	record.Subdivisions = subdivisionsOf("zh-CN", province, city)
+	if city != "" {
+		record.City.Names = map[string]string{"zh-CN": city}
+	}
+	record.Traits.ISP = englishISP(isp)
+	return &record
+}
+
+var (
+	countryCodesOnce sync.Once
+	countryCodes     map[string]string
+)
+
+// countryCode returns the iso code of the country with the zh-CN name, or
+// "" when it is not known.
+func countryCode(name string) string {
+	countryCodesOnce.Do(func() {
+		countryCodes = make(map[string]string)
+		for a := 'A'; a <= 'Z'; a++ {
+			for b := 'A'; b <= 'Z'; b++ {
+				region, err := language.ParseRegion(string([]rune{a, b}))
+				if err != nil || !region.IsCountry() {
+					continue
+				}
+				countryCodes[zhCNRegions.Name(region)] = region.String()
+			}
+		}
+	})
+	return countryCodes[name]
+}
+
+// The UN M.49 areas that make up every continent.
+var continentAreas = map[string][]string{
+	"AF": {"002"},
+	"AS": {"142"},
+	"EU": {"150"},
+	"NA": {"021", "013", "029"},
+	"SA": {"005"},
+	"OC": {"009"},
+}
+
+// continentCode returns the code of the continent of the country with the
+// iso code, or "" when it is not known.
+func continentCode(code string) string {
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return ""
+	}
+	if region.String() == "AQ" {
+		return "AN"
+	}
+	for continent, areas := range continentAreas {
+		for _, area := range areas {
+			if language.MustParseRegion(area).Contains(region) {
+				return continent
+			}
+		}
+	}
+	return ""
+}
+
+// englishISP returns the English name the ISP names have for a Chinese
+// ISP name, so that it is localized back by localizedISP, or isp itself.
+func englishISP(isp string) string {
+	if en, ok := ispNames.Load().english[isp]; ok {
+		return en
+	}
+	return isp
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type xdbSegment struct {
+	first, last string
+	region      string
+}
+
+// buildXDB returns an xdb of segments, which must be sorted, created at
+// 1700000000. Segments are split at /16 boundaries as the vector index
+// needs.
+func buildXDB(segments []xdbSegment) []byte {
+	ip := func(s string) uint32 {
+		a4 := netip.MustParseAddr(s).As4()
+		return binary.BigEndian.Uint32(a4[:])
+	}
+	content := make([]byte, xdbVectorIndexEnd)
+	regions := make(map[string]uint32)
+	for _, s := range segments {
+		if _, ok := regions[s.region]; !ok {
+			regions[s.region] = uint32(len(content))
+			content = append(content, s.region...)
+		}
+	}
+	start := uint32(len(content))
+	for _, s := range segments {
+		for first, last := ip(s.first), ip(s.last); ; first++ {
+			end := min(last, first|0xffff)
+			offset := uint32(len(content))
+			content = binary.LittleEndian.AppendUint32(content, first)
+			content = binary.LittleEndian.AppendUint32(content, end)
+			content = binary.LittleEndian.AppendUint16(content, uint16(len(s.region)))
+			content = binary.LittleEndian.AppendUint32(content, regions[s.region])
+
+			slot := xdbHeaderLength + (int(first>>24)*xdbVectorIndexCols+int(first>>16&0xff))*xdbVectorIndexSize
+			if binary.LittleEndian.Uint32(content[slot:]) == 0 {
+				binary.LittleEndian.PutUint32(content[slot:], offset)
+			}
+			binary.LittleEndian.PutUint32(content[slot+4:], offset+xdbSegmentIndexSize)
+			if first = end; first == last {
+				break
+			}
+		}
+	}
+	binary.LittleEndian.PutUint16(content, xdbStructure20)
+	binary.LittleEndian.PutUint16(content[2:], 1)
+	binary.LittleEndian.PutUint32(content[4:], 1700000000)
+	binary.LittleEndian.PutUint32(content[8:], start)
+	binary.LittleEndian.PutUint32(content[12:], uint32(len(content))-xdbSegmentIndexSize)
+	return content
+}
+
+var testXDBSegments = []xdbSegment{
+	{"1.0.0.0", "1.0.0.255", "中国|0|广东省|深圳市|电信"},
+	{"1.0.1.0", "1.0.3.255", "中国|0|福建省|福州市|联通"},
+	{"1.0.8.0", "1.1.0.255", "中国|0|0|0|0"},
+	{"8.8.8.0", "8.8.8.255", "美国|0|加利福尼亚|0|谷歌"},
+	{"255.255.255.0", "255.255.255.255", "0|0|0|内网IP|内网IP"},
+}
+
+func writeXDB(t *testing.T, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.xdb")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestXDBSearch(t *testing.T) {
+	path := writeXDB(t, buildXDB(testXDBSegments))
+	tests := []struct {
+		addr        string
+		region      string
+		first, last string
+	}{
+		{addr: "1.0.0.0", region: "中国|0|广东省|深圳市|电信", first: "1.0.0.0", last: "1.0.0.255"},
+		{addr: "1.0.0.255", region: "中国|0|广东省|深圳市|电信", first: "1.0.0.0", last: "1.0.0.255"},
+		{addr: "1.0.1.0", region: "中国|0|福建省|福州市|联通", first: "1.0.1.0", last: "1.0.3.255"},
+		{addr: "1.0.3.255", region: "中国|0|福建省|福州市|联通", first: "1.0.1.0", last: "1.0.3.255"},
+		// the segment is split at 1.1.0.0
+		{addr: "1.0.255.255", region: "中国|0|0|0|0", first: "1.0.8.0", last: "1.0.255.255"},
+		{addr: "1.1.0.0", region: "中国|0|0|0|0", first: "1.1.0.0", last: "1.1.0.255"},
+		{addr: "8.8.8.8", region: "美国|0|加利福尼亚|0|谷歌", first: "8.8.8.0", last: "8.8.8.255"},
+		{addr: "255.255.255.255", region: "0|0|0|内网IP|内网IP", first: "255.255.255.0", last: "255.255.255.255"},
+		// between the segments of a /16
+		{addr: "1.0.4.0"},
+		{addr: "8.8.7.255"},
+		{addr: "8.8.9.0"},
+		{addr: "1.1.1.0"},
+		// in /16s without segments
+		{addr: "0.0.0.0"},
+		{addr: "9.9.9.9"},
+	}
+	for _, inMemory := range []bool{true, false} {
+		x, err := openXDBFile(path, inMemory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer x.close()
+		if err := x.verify(); err != nil {
+			t.Fatal(err)
+		}
+		if x.createdAt != 1700000000 {
+			t.Errorf("createdAt = %d", x.createdAt)
+		}
+		for _, tt := range tests {
+			a4 := netip.MustParseAddr(tt.addr).As4()
+			region, start, end, err := x.search(binary.BigEndian.Uint32(a4[:]))
+			if err != nil {
+				t.Fatalf("%s: %v", tt.addr, err)
+			}
+			if region != tt.region {
+				t.Errorf("in memory %v: %s: region = %q, want %q", inMemory, tt.addr, region, tt.region)
+				continue
+			}
+			if region == "" {
+				continue
+			}
+			first, last := netip.AddrFrom4(uint32Bytes(start)).String(), netip.AddrFrom4(uint32Bytes(end)).String()
+			if first != tt.first || last != tt.last {
+				t.Errorf("in memory %v: %s: segment = %s-%s, want %s-%s", inMemory, tt.addr, first, last, tt.first, tt.last)
+			}
+		}
+	}
+}
+
+func TestXDBInvalid(t *testing.T) {
+	content := buildXDB(testXDBSegments)
+	version := append([]byte(nil), content...)
+	binary.LittleEndian.PutUint16(version, 3)
+	pointer := append([]byte(nil), content...)
+	binary.LittleEndian.PutUint32(pointer[12:], binary.LittleEndian.Uint32(pointer[12:])+1)
+	tests := []struct {
+		name    string
+		content []byte
+		err     string
+	}{
+		{name: "header only", content: content[:xdbHeaderLength], err: ""},
+		{name: "vector index", content: content[:xdbVectorIndexEnd-1], err: ""},
+		{name: "segment index", content: content[:len(content)-1], err: "invalid xdb segment index"},
+		{name: "regions", content: content[:xdbVectorIndexEnd+10], err: "invalid xdb segment index"},
+		{name: "version", content: version, err: "unsupported xdb version 3"},
+		{name: "unaligned segment index", content: pointer, err: "invalid xdb segment index"},
+	}
+	for _, tt := range tests {
+		for _, inMemory := range []bool{true, false} {
+			_, err := NewXDB(writeXDB(t, tt.content), inMemory, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s, in memory %v: error = %v, want it to contain %q", tt.name, inMemory, err, tt.err)
+			}
+		}
+	}
+}
+
+func TestXDBLookup(t *testing.T) {
+	path := writeXDB(t, buildXDB(testXDBSegments))
+	for _, inMemory := range []bool{true, false} {
+		db, err := NewXDB(path, inMemory, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		record, err := db.Lookup(netip.MustParseAddr("::ffff:1.0.2.1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Traits.Network != "1.0.2.0/23" || record.City.Names["zh-CN"] != "福州市" {
+			t.Errorf("in memory %v: record = %+v", inMemory, record)
+		}
+		for _, addr := range []string{"9.9.9.9", "2400:da00::1"} {
+			record, err := db.Lookup(netip.MustParseAddr(addr))
+			if err != nil || record.Country.IsoCode != "" || record.Traits.Network != "" {
+				t.Errorf("in memory %v: %s: %+v, %v", inMemory, addr, record, err)
+			}
+		}
+		if databases := db.Databases(); databases[0].BuildEpoch != 1700000000 {
+			t.Errorf("in memory %v: databases = %+v", inMemory, databases)
+		}
+	}
+}
+
+func TestXDBRecord(t *testing.T) {
+	tests := []struct {
+		region       string
+		code         string
+		continent    string
+		country      string
+		subdivisions []string
+		city         string
+		isp          string
+	}{
+		{region: "中国|0|广东省|深圳市|电信", code: "CN", continent: "AS", country: "中国", subdivisions: []string{"广东省", "深圳市"}, city: "深圳市", isp: "电信"},
+		{region: "美国|0|加利福尼亚|0|谷歌", code: "US", continent: "NA", country: "美国", subdivisions: []string{"加利福尼亚"}, isp: "谷歌"},
+		{region: "中国|0|0|0|0", code: "CN", continent: "AS", country: "中国"},
+		{region: "0|0|0|内网IP|内网IP", subdivisions: []string{"", "内网IP"}, city: "内网IP", isp: "内网IP"},
+		{region: "火星|0|0|0|0", country: "火星"},
+		{region: "中国", code: "CN", continent: "AS", country: "中国"},
+		{region: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			record := xdbRecord(tt.region)
+			if record.Country.IsoCode != tt.code || record.Continent.Code != tt.continent || record.Country.Names["zh-CN"] != tt.country {
+				t.Errorf("country = %s %s %q, want %s %s %q", record.Continent.Code, record.Country.IsoCode,
+					record.Country.Names["zh-CN"], tt.continent, tt.code, tt.country)
+			}
+			var subdivisions []string
+			for _, s := range record.Subdivisions {
+				subdivisions = append(subdivisions, s.Names["zh-CN"])
+			}
+			if strings.Join(subdivisions, ",") != strings.Join(tt.subdivisions, ",") || record.City.Names["zh-CN"] != tt.city {
+				t.Errorf("subdivisions, city = %q, %q, want %q, %q", subdivisions, record.City.Names["zh-CN"], tt.subdivisions, tt.city)
+			}
+			if got := localizedISP(record.Traits.ISP, "zh-CN"); got != tt.isp {
+				t.Errorf("isp = %q, want %q", got, tt.isp)
+			}
+		})
+	}
+}